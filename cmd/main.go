@@ -19,6 +19,12 @@ func main() {
 	engine := serverConfig.Gin
 
 	routes.ImageRoutes(engine, serverConfig.Middleware, serverConfig.Controller.ImageController)
+	routes.WebhookRoutes(engine, serverConfig.Middleware, serverConfig.Controller.WebhookController)
+	routes.WatermarkRoutes(engine, serverConfig.Middleware, serverConfig.Controller.WatermarkController)
+	routes.ProfileRoutes(engine, serverConfig.Middleware, serverConfig.Controller.ProfileController)
+	routes.AliasRoutes(engine, serverConfig.Middleware, serverConfig.Controller.AliasController)
+	routes.UploadTokenRoutes(engine, serverConfig.Middleware, serverConfig.Controller.UploadTokenController)
+	routes.ModerationRoutes(engine, serverConfig.Middleware, serverConfig.Controller.ModerationController)
 
 	// Run server
 	log.Println("Starting server on :8181")
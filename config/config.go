@@ -25,6 +25,65 @@ type Config struct {
 	Nats             string `envconfig:"NATS_URL" default:"nats://localhost:4222"`
 	UploadDir        string `envconfig:"UPLOAD_DIR" default:"/tmp/uploads"`
 	ProfileUploadDir string `envconfig:"PROFILE_UPLOAD_DIR" default:"/tmp/uploads/profile"`
+	VariantDir       string `envconfig:"VARIANT_DIR" default:"/tmp/variants"`
+	WatermarkDir     string `envconfig:"WATERMARK_DIR" default:"/tmp/watermarks"`
+	URLSigningSecret string `envconfig:"URL_SIGNING_SECRET" default:""` // Falls back to JWT_SECRET
+
+	MaxUploadFileSize    int64 `envconfig:"MAX_UPLOAD_FILE_SIZE" default:"10485760"`    // Bytes per file
+	MaxUploadRequestSize int64 `envconfig:"MAX_UPLOAD_REQUEST_SIZE" default:"52428800"` // Bytes per request, form fields included
+	MaxUploadFiles       int   `envconfig:"MAX_UPLOAD_FILES" default:"20"`
+	UploadWorkers        int   `envconfig:"UPLOAD_WORKERS" default:"4"` // Files of a batch processed in parallel
+
+	UploadTokenTTL      time.Duration `envconfig:"UPLOAD_TOKEN_TTL" default:"15m"`
+	UploadTokenMaxTTL   time.Duration `envconfig:"UPLOAD_TOKEN_MAX_TTL" default:"1h"`
+	UploadTokenMaxCount int           `envconfig:"UPLOAD_TOKEN_MAX_COUNT" default:"100"` // Files one token may upload
+	UploadTokenSecret   string        `envconfig:"UPLOAD_TOKEN_SECRET" default:""`       // Falls back to JWT_SECRET
+
+	IdempotencyTTL     time.Duration `envconfig:"IDEMPOTENCY_TTL" default:"24h"`     // How long responses are replayed
+	IdempotencyLockTTL time.Duration `envconfig:"IDEMPOTENCY_LOCK_TTL" default:"5m"` // How long an unfinished request holds its key
+
+	FetchTimeout         time.Duration `envconfig:"FETCH_TIMEOUT" default:"15s"`
+	FetchMaxSize         int64         `envconfig:"FETCH_MAX_SIZE" default:"0"` // Bytes, falls back to MAX_UPLOAD_FILE_SIZE
+	FetchMaxRedirects    int           `envconfig:"FETCH_MAX_REDIRECTS" default:"3"`
+	FetchAllowedNetworks string        `envconfig:"FETCH_ALLOWED_NETWORKS" default:""` // CIDRs exempt from the private address block
+
+	ImagePresets       string `envconfig:"IMAGE_PRESETS" default:"avatar_64:64x64:cover:profile,avatar_256:256x256:cover:profile,card_480:480x0:contain,full_1600:1600x0:contain"`
+	ResizeMaxDimension int    `envconfig:"RESIZE_MAX_DIMENSION" default:"4096"`
+	ResizeStep         int    `envconfig:"RESIZE_STEP" default:"100"` // Ad-hoc sizes must be multiples of it
+	VariantWorkers     int    `envconfig:"VARIANT_WORKERS" default:"2"`
+	VariantQueueSize   int    `envconfig:"VARIANT_QUEUE_SIZE" default:"256"`
+	RasterizeSVG       bool   `envconfig:"RASTERIZE_SVG" default:"true"` // Render SVG variants as PNG instead of serving the vector
+
+	MaxImagePixels       int64         `envconfig:"MAX_IMAGE_PIXELS" default:"50000000"`
+	MaxImageFrames       int           `envconfig:"MAX_IMAGE_FRAMES" default:"300"`
+	MaxDecodeMemory      int64         `envconfig:"MAX_DECODE_MEMORY" default:"268435456"` // Bytes, estimated from the header
+	MaxAnimationDuration time.Duration `envconfig:"MAX_ANIMATION_DURATION" default:"60s"`
+	ImageWorkers         int           `envconfig:"IMAGE_WORKERS" default:"4"`
+	ImageTimeout         time.Duration `envconfig:"IMAGE_TIMEOUT" default:"30s"`
+
+	ProfileMaxSize     int    `envconfig:"PROFILE_MAX_SIZE" default:"1024"` // Side of normalized profile photos
+	ProfileFormat      string `envconfig:"PROFILE_FORMAT" default:"jpeg"`   // jpeg or png
+	ProfileQuality     int    `envconfig:"PROFILE_QUALITY" default:"85"`
+	ProfileHistorySize int    `envconfig:"PROFILE_HISTORY_SIZE" default:"5"` // Photos kept per client, the current one included
+
+	Scanner            string        `envconfig:"SCANNER" default:"none"` // none or clamd
+	ClamdAddress       string        `envconfig:"CLAMD_ADDRESS" default:"tcp://localhost:3310"`
+	ScanTimeout        time.Duration `envconfig:"SCAN_TIMEOUT" default:"30s"`
+	ScanFailOpen       bool          `envconfig:"SCAN_FAIL_OPEN" default:"false"`        // Accept uploads when the scanner fails
+	ScanInfectedAction string        `envconfig:"SCAN_INFECTED_ACTION" default:"reject"` // reject or quarantine
+	QuarantineDir      string        `envconfig:"QUARANTINE_DIR" default:"/tmp/quarantine"`
+
+	Moderation                 string        `envconfig:"MODERATION" default:"none"` // none, manual or classifier
+	ModerationClassifierURL    string        `envconfig:"MODERATION_CLASSIFIER_URL" default:""`
+	ModerationClassifierSecret string        `envconfig:"MODERATION_CLASSIFIER_SECRET" default:""` // Signs the images sent to the classifier
+	ModerationTimeout          time.Duration `envconfig:"MODERATION_TIMEOUT" default:"30s"`
+	ModerationWorkers          int           `envconfig:"MODERATION_WORKERS" default:"2"` // Images classified in parallel
+
+	DuplicateMaxDistance int `envconfig:"DUPLICATE_MAX_DISTANCE" default:"10"` // Hamming distance out of 64 bits
+
+	WebhookTimeout         time.Duration `envconfig:"WEBHOOK_TIMEOUT" default:"10s"`
+	WebhookMaxAttempts     int           `envconfig:"WEBHOOK_MAX_ATTEMPTS" default:"8"`
+	WebhookAllowedNetworks string        `envconfig:"WEBHOOK_ALLOWED_NETWORKS" default:""` // CIDRs exempt from the private address block
 }
 
 func initDir() {
@@ -2,7 +2,11 @@ package config
 
 import (
 	"cdn-service/internal/controller"
+	"cdn-service/internal/imaging"
 	"cdn-service/internal/middleware"
+	"cdn-service/internal/moderation"
+	"cdn-service/internal/repository"
+	"cdn-service/internal/scanner"
 	"cdn-service/internal/services"
 	"cdn-service/internal/utils"
 	"encoding/json"
@@ -12,7 +16,6 @@ import (
 	"github.com/rs/zerolog/log"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 )
 
@@ -49,18 +52,102 @@ func NewServerConfig() (*ServerConfig, error) {
 	server.initController()
 	server.initMiddleware()
 	go server.initNats(cfg.Nats)
+	go server.Services.WebhookService.Run()
+	server.Services.VariantService.Run()
 	return server, nil
 }
 
 // initRepository initializes database access objects (Repository)
 func (s *ServerConfig) initRepository() {
-	s.Repository = Repository{}
+	s.Repository = Repository{
+		WebhookRepository:       repository.NewWebhookRepository(s.Redis),
+		ImageMetadataRepository: repository.NewImageMetadataRepository(s.Redis),
+		WatermarkRepository:     repository.NewWatermarkRepository(s.Redis),
+		ProfileRepository:       repository.NewProfileRepository(s.Redis),
+		AliasRepository:         repository.NewAliasRepository(s.Redis),
+		IdempotencyRepository:   repository.NewIdempotencyRepository(s.Redis),
+		UploadTokenRepository:   repository.NewUploadTokenRepository(s.Redis),
+		ModerationRepository:    repository.NewModerationRepository(s.Redis),
+	}
 }
 
 // initServices initializes the application services
 func (s *ServerConfig) initServices() {
+	presets, err := imaging.ParsePresets(s.Config.ImagePresets)
+	if err != nil {
+		log.Fatal().Err(err).Msg("❌ Invalid IMAGE_PRESETS")
+	}
+
+	imaging.SetLimits(imaging.Limits{
+		MaxPixels:   s.Config.MaxImagePixels,
+		MaxFrames:   s.Config.MaxImageFrames,
+		MaxMemory:   s.Config.MaxDecodeMemory,
+		MaxDuration: s.Config.MaxAnimationDuration,
+	})
+	if !imaging.ValidProfileFormat(s.Config.ProfileFormat) {
+		log.Fatal().Msgf("❌ Invalid PROFILE_FORMAT %q, expected jpeg or png", s.Config.ProfileFormat)
+	}
+	profileOptions := imaging.ProfileOptions{
+		MaxSize: s.Config.ProfileMaxSize,
+		Format:  s.Config.ProfileFormat,
+		Quality: s.Config.ProfileQuality,
+	}
+	uploadTokenSecret := s.Config.UploadTokenSecret
+	if uploadTokenSecret == "" {
+		uploadTokenSecret = s.Config.JWTSecret
+	}
+	var fileScanner scanner.Scanner = scanner.Noop{}
+	switch s.Config.Scanner {
+	case "none":
+	case "clamd":
+		clamd, err := scanner.NewClamd(s.Config.ClamdAddress, s.Config.ScanTimeout)
+		if err != nil {
+			log.Fatal().Err(err).Msg("❌ Invalid CLAMD_ADDRESS")
+		}
+		fileScanner = clamd
+	default:
+		log.Fatal().Msgf("❌ Invalid SCANNER %q, expected none or clamd", s.Config.Scanner)
+	}
+	scanService, err := services.NewScanService(fileScanner, s.Config.ScanFailOpen, s.Config.ScanInfectedAction, s.Config.QuarantineDir)
+	if err != nil {
+		log.Fatal().Err(err).Msg("❌ Invalid SCAN_INFECTED_ACTION")
+	}
+	var moderator moderation.Moderator
+	switch s.Config.Moderation {
+	case "none":
+	case "manual":
+		moderator = moderation.Manual{}
+	case "classifier":
+		classifier, err := moderation.NewClassifier(s.Config.ModerationClassifierURL, s.Config.ModerationClassifierSecret)
+		if err != nil {
+			log.Fatal().Err(err).Msg("❌ Invalid MODERATION_CLASSIFIER_URL")
+		}
+		moderator = classifier
+	default:
+		log.Fatal().Msgf("❌ Invalid MODERATION %q, expected none, manual or classifier", s.Config.Moderation)
+	}
+	pool := imaging.NewPool(s.Config.ImageWorkers, s.Config.ImageTimeout)
+
+	webhookNetworks, err := utils.ParseNetworks(s.Config.WebhookAllowedNetworks)
+	if err != nil {
+		log.Fatal().Err(err).Msg("❌ Invalid WEBHOOK_ALLOWED_NETWORKS")
+	}
+	webhookService := services.NewWebhookService(s.Repository.WebhookRepository, s.Config.WebhookTimeout, s.Config.WebhookMaxAttempts, webhookNetworks)
+	variantService := services.NewVariantService(s.Config.VariantDir, presets, s.Config.ResizeMaxDimension, s.Config.ResizeStep, s.Config.VariantWorkers, s.Config.VariantQueueSize, s.Config.RasterizeSVG, pool)
+	watermarkService := services.NewWatermarkService(s.Repository.WatermarkRepository, variantService, s.Config.WatermarkDir, pool)
+	moderationService := services.NewModerationService(s.Repository.ModerationRepository, s.Repository.ImageMetadataRepository, webhookService, moderator, s.Config.ModerationTimeout, s.Config.ModerationWorkers)
+	profileService := services.NewProfileService(s.Repository.ProfileRepository, s.Repository.ImageMetadataRepository, variantService, moderationService, webhookService, s.Config.ProfileUploadDir, s.Config.ProfileHistorySize)
+	imageService := services.NewImageService(s.Redis, s.Repository.ImageMetadataRepository, webhookService, variantService, watermarkService, profileService, scanService, moderationService, pool, s.Config.UploadDir, s.Config.ProfileUploadDir, s.Config.DuplicateMaxDistance, profileOptions, s.Config.UploadWorkers)
 	s.Services = Services{
-		ImageService: services.NewImageService(s.Redis, s.Config.UploadDir, s.Config.ProfileUploadDir),
+		WebhookService:     webhookService,
+		VariantService:     variantService,
+		WatermarkService:   watermarkService,
+		ProfileService:     profileService,
+		ScanService:        scanService,
+		ModerationService:  moderationService,
+		ImageService:       imageService,
+		AliasService:       services.NewAliasService(s.Repository.AliasRepository, imageService, profileService),
+		UploadTokenService: services.NewUploadTokenService(s.Repository.UploadTokenRepository, uploadTokenSecret, s.Config.MaxUploadFileSize, s.Config.UploadTokenMaxCount, s.Config.UploadTokenTTL, s.Config.UploadTokenMaxTTL),
 	}
 }
 
@@ -71,14 +158,48 @@ func (s *ServerConfig) Start() error {
 }
 
 func (s *ServerConfig) initController() {
+	urlSigningSecret := s.Config.URLSigningSecret
+	if urlSigningSecret == "" {
+		urlSigningSecret = s.Config.JWTSecret
+	}
+
+	uploadLimits := utils.UploadLimits{
+		MaxFileSize:    s.Config.MaxUploadFileSize,
+		MaxRequestSize: s.Config.MaxUploadRequestSize,
+		MaxFiles:       s.Config.MaxUploadFiles,
+	}
+
+	allowedNetworks, err := utils.ParseNetworks(s.Config.FetchAllowedNetworks)
+	if err != nil {
+		log.Fatal().Err(err).Msg("❌ Invalid FETCH_ALLOWED_NETWORKS")
+	}
+	fetchMaxSize := s.Config.FetchMaxSize
+	if fetchMaxSize <= 0 {
+		fetchMaxSize = s.Config.MaxUploadFileSize
+	}
+	fetcher := utils.NewFetcher(utils.FetchOptions{
+		Timeout:         s.Config.FetchTimeout,
+		MaxSize:         fetchMaxSize,
+		MaxRedirects:    s.Config.FetchMaxRedirects,
+		AllowedNetworks: allowedNetworks,
+		ContentTypes:    []string{"image/jpeg", "image/png", "image/gif", "image/webp", "image/svg+xml"},
+	})
+
 	s.Controller = Controller{
-		ImageController: controller.NewImageController(s.Services.ImageService, s.JWTService),
+		ImageController:       controller.NewImageController(s.Services.ImageService, s.Services.AliasService, s.JWTService, urlSigningSecret, uploadLimits, fetcher, s.Services.UploadTokenService, s.Services.ModerationService),
+		WebhookController:     controller.NewWebhookController(s.Services.WebhookService, s.JWTService),
+		WatermarkController:   controller.NewWatermarkController(s.Services.WatermarkService, s.JWTService, uploadLimits),
+		ProfileController:     controller.NewProfileController(s.Services.ProfileService, s.Services.ImageService, s.Services.ModerationService, s.JWTService),
+		AliasController:       controller.NewAliasController(s.Services.AliasService, s.JWTService),
+		UploadTokenController: controller.NewUploadTokenController(s.Services.UploadTokenService, s.JWTService),
+		ModerationController:  controller.NewModerationController(s.Services.ModerationService, s.JWTService),
 	}
 }
 
 func (s *ServerConfig) initMiddleware() {
 	s.Middleware = Middleware{
-		AuthMiddleware: middleware.NewAuthMiddleware(s.JWTService),
+		AuthMiddleware:        middleware.NewAuthMiddleware(s.JWTService, s.Services.UploadTokenService),
+		IdempotencyMiddleware: middleware.NewIdempotencyMiddleware(s.Repository.IdempotencyRepository, s.Config.IdempotencyTTL, s.Config.IdempotencyLockTTL, s.Config.MaxUploadRequestSize),
 	}
 }
 
@@ -112,36 +233,10 @@ func (s *ServerConfig) initNats(apiNats string) {
 		}
 
 		// Delete images
-		deleted, failed := DeleteImages(request.ClientID, request.Images)
+		deleted, failed := s.Services.ImageService.DeleteImages(request.ClientID, request.Images)
 		log.Log().Msgf("Deleted: %v, Failed: %v", deleted, failed)
 
 	})
 
 	select {} // Keep the subscriber running indefinitely
 }
-
-// DeleteImages removes files from storage
-func DeleteImages(clientID string, images []string) ([]string, []string) {
-	var deleted []string
-	var failed []string
-
-	for _, img := range images {
-		filePath := filepath.Join(utils.UploadDir, clientID, img)
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			fmt.Println("⚠️ File not found:", filePath)
-			failed = append(failed, img)
-			continue
-		}
-
-		err := os.Remove(filePath)
-		if err != nil {
-			fmt.Println("❌ Failed to delete:", filePath)
-			failed = append(failed, img)
-		} else {
-			fmt.Println("✅ Deleted:", filePath)
-			deleted = append(deleted, img)
-		}
-	}
-
-	return deleted, failed
-}
@@ -3,6 +3,7 @@ package config
 import (
 	"cdn-service/internal/controller"
 	"cdn-service/internal/middleware"
+	"cdn-service/internal/repository"
 	"cdn-service/internal/services"
 	"cdn-service/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -22,7 +23,15 @@ type ServerConfig struct {
 
 // Services holds all service dependencies
 type Services struct {
-	ImageService services.ImageService
+	ImageService       services.ImageService
+	WebhookService     services.WebhookService
+	VariantService     services.VariantService
+	WatermarkService   services.WatermarkService
+	ProfileService     services.ProfileService
+	ScanService        services.ScanService
+	ModerationService  services.ModerationService
+	AliasService       services.AliasService
+	UploadTokenService services.UploadTokenService
 	//AuthService        services.AuthService
 	//UserSessionService services.UsersSessionService
 	//ResourceService    services.ResourceService
@@ -31,6 +40,14 @@ type Services struct {
 
 // Repository contains repository (database access objects)
 type Repository struct {
+	WebhookRepository       repository.WebhookRepository
+	ImageMetadataRepository repository.ImageMetadataRepository
+	WatermarkRepository     repository.WatermarkRepository
+	ProfileRepository       repository.ProfileRepository
+	AliasRepository         repository.AliasRepository
+	IdempotencyRepository   repository.IdempotencyRepository
+	UploadTokenRepository   repository.UploadTokenRepository
+	ModerationRepository    repository.ModerationRepository
 	//AuthRepo         repository.AuthRepository
 	//UserRepo         repository.UserRepository
 	//ResourceRepo     repository.ResourceRepository
@@ -41,12 +58,19 @@ type Repository struct {
 }
 
 type Controller struct {
-	ImageController controller.ImageController
+	ImageController       controller.ImageController
+	WebhookController     controller.WebhookController
+	WatermarkController   controller.WatermarkController
+	ProfileController     controller.ProfileController
+	AliasController       controller.AliasController
+	UploadTokenController controller.UploadTokenController
+	ModerationController  controller.ModerationController
 	//AuthHandler     handler.AuthHandler
 	//ResourceHandler handler.ResourceHandler
 	//RoleHandler     handler.RoleHandler
 }
 
 type Middleware struct {
-	AuthMiddleware middleware.AuthMiddleware
+	AuthMiddleware        middleware.AuthMiddleware
+	IdempotencyMiddleware middleware.IdempotencyMiddleware
 }
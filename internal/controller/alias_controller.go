@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"cdn-service/internal/dto/in"
+	"cdn-service/internal/services"
+	"cdn-service/internal/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+type AliasController interface {
+	SetAlias(context *gin.Context)
+	GetAlias(context *gin.Context)
+	ListAliases(context *gin.Context)
+	DeleteAlias(context *gin.Context)
+}
+
+type aliasController struct {
+	AliasService services.AliasService
+	JWTService   utils.JWTService
+}
+
+func NewAliasController(aliasService services.AliasService, jwtService utils.JWTService) AliasController {
+	return aliasController{AliasService: aliasService, JWTService: jwtService}
+}
+
+func (h aliasController) SetAlias(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var request in.AliasRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	alias, err := h.AliasService.SetAlias(token.ClientID, context.Param("alias"), request.Filename)
+	if errors.Is(err, services.ErrInvalidAlias) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": alias})
+}
+
+func (h aliasController) GetAlias(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	alias, err := h.AliasService.GetAlias(token.ClientID, context.Param("alias"))
+	if errors.Is(err, services.ErrAliasNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": alias})
+}
+
+func (h aliasController) ListAliases(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	aliases, err := h.AliasService.ListAliases(token.ClientID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": aliases})
+}
+
+func (h aliasController) DeleteAlias(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	err = h.AliasService.DeleteAlias(token.ClientID, context.Param("alias"))
+	if errors.Is(err, services.ErrInvalidAlias) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrAliasNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
@@ -1,27 +1,63 @@
 package controller
 
 import (
+	"cdn-service/internal/dto/in"
+	response "cdn-service/internal/dto/out"
+	"cdn-service/internal/imaging"
 	"cdn-service/internal/services"
 	"cdn-service/internal/utils"
+	"cdn-service/models/metadata"
+	"cdn-service/models/uploadtoken"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ImageController interface {
 	UploadPhotoProfile(context *gin.Context)
 	UploadImages(context *gin.Context)
+	UploadFromURL(context *gin.Context)
+	UploadPhotoProfileJSON(context *gin.Context)
+	UploadImageJSON(context *gin.Context)
 	GetImage(context *gin.Context)
+	GetImageVariant(context *gin.Context)
+	ListImages(context *gin.Context)
+	GetImageExif(context *gin.Context)
+	GetImageMetadata(context *gin.Context)
+	BackfillMetadata(context *gin.Context)
+	SetImageFocus(context *gin.Context)
+	ClearImageFocus(context *gin.Context)
+	SignImageURL(context *gin.Context)
+	FindDuplicates(context *gin.Context)
+	FindDuplicatesOf(context *gin.Context)
+	DeleteImage(context *gin.Context)
 }
 
+const (
+	defaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
 type imageController struct {
-	ImageService services.ImageService
-	JWTService   utils.JWTService
+	ImageService       services.ImageService
+	AliasService       services.AliasService
+	JWTService         utils.JWTService
+	URLSigningSecret   string
+	UploadLimits       utils.UploadLimits
+	Fetcher            *utils.Fetcher
+	UploadTokenService services.UploadTokenService
+	ModerationService  services.ModerationService
 }
 
-func NewImageController(imageService services.ImageService, jwtService utils.JWTService) ImageController {
-	return imageController{ImageService: imageService, JWTService: jwtService}
+func NewImageController(imageService services.ImageService, aliasService services.AliasService, jwtService utils.JWTService, urlSigningSecret string, uploadLimits utils.UploadLimits, fetcher *utils.Fetcher, uploadTokenService services.UploadTokenService, moderationService services.ModerationService) ImageController {
+	return imageController{ImageService: imageService, AliasService: aliasService, JWTService: jwtService, URLSigningSecret: urlSigningSecret, UploadLimits: uploadLimits, Fetcher: fetcher, UploadTokenService: uploadTokenService, ModerationService: moderationService}
 }
 
 func (h imageController) UploadPhotoProfile(context *gin.Context) {
@@ -32,17 +68,30 @@ func (h imageController) UploadPhotoProfile(context *gin.Context) {
 		return
 	}
 
-	file, err := context.FormFile("image") // 🔁 field must be "image"
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to get file from form")
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from form"})
+	limits := h.UploadLimits
+	limits.MaxFiles = 1
+	form, ok := h.streamUpload(context, "image", h.ImageService.StagingDir(token.ClientID, imaging.ScopeProfile), limits) // 🔁 field must be "image"
+	if !ok {
 		return
 	}
+	defer form.Cleanup()
 
-	log.Info().Msgf("Uploading image: %s", file.Filename)
+	log.Info().Msgf("Uploading image: %s", form.Files[0].Filename)
 
-	imageURL, err := h.ImageService.UploadPhotoProfile(file, token.ClientID)
+	options, err := uploadOptions(form.Value)
 	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	imageURL, err := h.ImageService.UploadPhotoProfile(form.Files[0], token.ClientID, options)
+	if errors.Is(err, services.ErrScannerUnavailable) {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	} else if unprocessable(err) {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -51,15 +100,479 @@ func (h imageController) UploadPhotoProfile(context *gin.Context) {
 }
 
 func (h imageController) UploadImages(context *gin.Context) {
-	// Parse form data
-	err := context.Request.ParseMultipartForm(10 << 20) // 10MB limit
+	// The user token or the presigned upload token, see AuthMiddleware.UploadHandler
+	token, ok := utils.ExtractTokenClaims(context)
+	if !ok {
+		return
+	}
+	scope := uploadScope(context)
+
+	// Stream the images straight into the client's storage directory
+	form, ok := h.streamUpload(context, "images", h.ImageService.StagingDir(token.ClientID, imaging.ScopeAsset), scopedLimits(h.UploadLimits, scope))
+	if !ok {
+		return
+	}
+	defer form.Cleanup()
+	log.Info().Msgf("Uploading %d images", len(form.Files))
+
+	options, err := uploadOptions(form.Value)
 	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.reserveUploads(context, scope, len(form.Files), &options) {
+		return
+	}
+
+	// Call service to upload images
+	results, err := h.ImageService.UploadImages(form.Files, token.ClientID, options)
+	if scope != nil {
+		var stored []response.ImageResponse
+		for _, result := range results {
+			if result.Image != nil && (result.Status == response.UploadCreated || result.Status == response.UploadDuplicate) {
+				stored = append(stored, *result.Image)
+			}
+		}
+		h.settleUploads(scope, len(form.Files), stored)
+	}
+	if errors.Is(err, services.ErrBatchRolledBack) {
+		// Nothing was kept; answer with the status of the first failure
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrDuplicateImage) {
+			status = http.StatusConflict
+		} else if errors.Is(err, services.ErrTypeNotAllowed) {
+			status = http.StatusUnsupportedMediaType
+		} else if errors.Is(err, services.ErrScannerUnavailable) {
+			status = http.StatusServiceUnavailable
+		} else if unprocessable(err) {
+			status = http.StatusUnprocessableEntity
+		}
+		context.JSON(status, gin.H{"error": err.Error(), "data": results})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Multi-Status when any file failed, so clients inspect each result
+	status := http.StatusCreated
+	for _, result := range results {
+		if result.Status == response.UploadFailed {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+	context.JSON(status, gin.H{"data": results})
+}
+
+// UploadFromURL imports an image that the server downloads itself
+func (h imageController) UploadFromURL(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var request in.URLUploadRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	options, err := uploadOptions(func(name string) string {
+		switch name {
+		case "preserve_metadata":
+			return strconv.FormatBool(request.PreserveMetadata)
+		case "duplicates":
+			return request.Duplicates
+		}
+		return ""
+	})
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, err := h.Fetcher.Fetch(context.Request.Context(), request.URL, h.ImageService.StagingDir(token.ClientID, imaging.ScopeAsset))
+	switch {
+	case errors.Is(err, utils.ErrInvalidURL), errors.Is(err, utils.ErrBlockedDestination):
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, utils.ErrFileTooLarge):
+		context.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, utils.ErrRemoteContentType):
+		context.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, utils.ErrRemoteFetchTimedOut):
+		context.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, utils.ErrRemoteStatus), errors.Is(err, utils.ErrTooManyRedirects):
+		context.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Filename != "" {
+		file.Filename = filepath.Base(request.Filename)
+	}
+	log.Info().Msgf("Imported %s (%d bytes) for client %s", request.URL, file.Size, token.ClientID)
+
+	image, err := h.ImageService.UploadImage(file, token.ClientID, options)
+	if errors.Is(err, services.ErrDuplicateImage) {
+		context.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrScannerUnavailable) {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	} else if unprocessable(err) {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusCreated, gin.H{"data": image})
+}
+
+// UploadPhotoProfileJSON is UploadPhotoProfile for clients that can only send
+// JSON, with the photo base64 encoded
+func (h imageController) UploadPhotoProfileJSON(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var request in.ImageRequest
+	file, form, ok := h.streamJSON(context, h.ImageService.StagingDir(token.ClientID, imaging.ScopeProfile), h.UploadLimits, &request)
+	if !ok {
+		return
+	}
+	defer form.Cleanup()
+
+	log.Info().Msgf("Uploading image: %s", file.Filename)
+
+	imageURL, err := h.ImageService.UploadPhotoProfile(file, token.ClientID, jsonUploadOptions(request))
+	if errors.Is(err, services.ErrScannerUnavailable) {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	} else if unprocessable(err) {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusCreated, gin.H{"data": imageURL})
+}
+
+// UploadImageJSON stores one base64 encoded image sent as JSON
+func (h imageController) UploadImageJSON(context *gin.Context) {
+	// The user token or the presigned upload token, see AuthMiddleware.UploadHandler
+	token, ok := utils.ExtractTokenClaims(context)
+	if !ok {
+		return
+	}
+	scope := uploadScope(context)
+
+	var request in.ImageRequest
+	file, form, ok := h.streamJSON(context, h.ImageService.StagingDir(token.ClientID, imaging.ScopeAsset), scopedLimits(h.UploadLimits, scope), &request)
+	if !ok {
+		return
+	}
+	defer form.Cleanup()
+
+	log.Info().Msgf("Uploading image: %s", file.Filename)
+
+	options := jsonUploadOptions(request)
+	if !h.reserveUploads(context, scope, 1, &options) {
+		return
+	}
+	image, err := h.ImageService.UploadImage(file, token.ClientID, options)
+	if scope != nil {
+		var stored []response.ImageResponse
+		if err == nil {
+			stored = append(stored, image)
+		}
+		h.settleUploads(scope, 1, stored)
+	}
+	if errors.Is(err, services.ErrDuplicateImage) {
+		context.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrTypeNotAllowed) {
+		context.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrScannerUnavailable) {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	} else if unprocessable(err) {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusCreated, gin.H{"data": image})
+}
+
+// streamJSON decodes a JSON upload, staging its image like a multipart file.
+// It answers the request itself when the body is invalid, exceeds a limit or
+// carries no image.
+func (h imageController) streamJSON(context *gin.Context, dir string, limits utils.UploadLimits, request *in.ImageRequest) (in.UploadFile, *utils.StagedForm, bool) {
+	form, err := utils.StreamJSON(context.Request, "image", dir, limits, request)
+	if errors.Is(err, utils.ErrFileTooLarge) || errors.Is(err, utils.ErrRequestTooLarge) {
+		context.Header("Connection", "close")
+		context.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return in.UploadFile{}, nil, false
+	} else if checksumFailed(context, err) {
+		return in.UploadFile{}, nil, false
+	} else if errors.Is(err, utils.ErrMalformedJSON) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return in.UploadFile{}, nil, false
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return in.UploadFile{}, nil, false
+	}
+	if !utils.CheckStagedForm(context, form) {
+		form.Cleanup()
+		return in.UploadFile{}, nil, false
+	}
+
+	if len(form.Files) == 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "No image uploaded"})
+		return in.UploadFile{}, nil, false
+	}
+	if request.SHA256 != "" {
+		if err := utils.VerifyChecksums(form.Files, []string{request.SHA256}); err != nil {
+			form.Cleanup()
+			checksumFailed(context, err)
+			return in.UploadFile{}, nil, false
+		}
+	}
+	if request.Duplicates != "" && request.Duplicates != in.DuplicatesReject && request.Duplicates != in.DuplicatesLink {
+		form.Cleanup()
+		context.JSON(http.StatusBadRequest, gin.H{"error": "duplicates must be reject or link"})
+		return in.UploadFile{}, nil, false
+	}
+	if (request.FocalX == nil) != (request.FocalY == nil) || !fraction(request.FocalX) || !fraction(request.FocalY) {
+		form.Cleanup()
+		context.JSON(http.StatusBadRequest, gin.H{"error": "focal_x and focal_y must both be fractions between 0 and 1"})
+		return in.UploadFile{}, nil, false
+	}
+
+	if request.Filename != "" {
+		form.Files[0].Filename = filepath.Base(request.Filename)
+	}
+	return form.Files[0], form, true
+}
+
+// reserveUploads counts files against a presigned upload token and restricts
+// options to its allowed types, or to images when it allows any. It answers the request itself when the token
+// has no uploads left. Without a token there is nothing to do.
+func (h imageController) reserveUploads(context *gin.Context, scope *uploadtoken.Scope, count int, options *in.UploadOptions) bool {
+	if scope == nil {
+		return true
+	}
+	err := h.UploadTokenService.Reserve(scope, count)
+	if errors.Is(err, services.ErrUploadTokenExhausted) {
+		context.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	options.ImagesOnly = true
+	for _, contentType := range scope.AllowedTypes {
+		options.AllowedFormats = append(options.AllowedFormats, imaging.FormatFromContentType(contentType))
+	}
+	return true
+}
+
+// settleUploads gives back the reserved uploads of a presigned upload token
+// that were not stored and points the token's alias at the last stored image
+func (h imageController) settleUploads(scope *uploadtoken.Scope, reserved int, stored []response.ImageResponse) {
+	h.UploadTokenService.Release(scope, reserved-len(stored))
+	if scope.Alias == "" || len(stored) == 0 {
+		return
+	}
+	filename := path.Base(stored[len(stored)-1].ImageURL)
+	if _, err := h.AliasService.SetAlias(scope.ClientID, scope.Alias, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to point alias %s at %s", scope.Alias, filename)
+	}
+}
+
+// streamUpload reads a multipart upload part by part into staging files,
+// answering the request itself when the form is invalid, exceeds a limit or
+// carries no file
+func (h imageController) streamUpload(context *gin.Context, field, dir string, limits utils.UploadLimits) (*utils.StagedForm, bool) {
+	form, ok := streamForm(context, field, dir, limits)
+	if !ok {
+		return nil, false
+	}
+
+	if len(form.Files) == 0 {
+		form.Cleanup()
+		context.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		return nil, false
+	}
+	// Optional per-file SHA-256 fields, in the order of the files
+	if err := utils.VerifyChecksums(form.Files, form.Values["sha256"]); err != nil {
+		form.Cleanup()
+		checksumFailed(context, err)
+		return nil, false
+	}
+	return form, true
+}
+
+// streamForm reads a multipart form part by part into staging files,
+// answering the request itself when the form is invalid or exceeds a limit
+func streamForm(context *gin.Context, field, dir string, limits utils.UploadLimits) (*utils.StagedForm, bool) {
+	form, err := utils.StreamMultipart(context.Request, field, dir, limits)
+	if errors.Is(err, utils.ErrFileTooLarge) || errors.Is(err, utils.ErrRequestTooLarge) || errors.Is(err, utils.ErrTooManyFiles) {
+		// Stop reading whatever the client is still sending
+		context.Header("Connection", "close")
+		context.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return nil, false
+	} else if checksumFailed(context, err) {
+		return nil, false
+	} else if errors.Is(err, utils.ErrMalformedForm) {
 		log.Error().Err(err).Msg("Failed to parse form")
 		context.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+		return nil, false
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !utils.CheckStagedForm(context, form) {
+		form.Cleanup()
+		return nil, false
+	}
+	return form, true
+}
+
+func (h imageController) GetImage(context *gin.Context) {
+	clientID := context.Param("clientID")
+	filename := context.Param("filename")
+	if clientID == "" || filename == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID or filename"})
+		return
+	}
+
+	filename, cache, ok := h.resolve(context, clientID, filename)
+	if !ok {
+		return
+	}
+	privileged, ok := moderationGate(context, h.ModerationService, h.JWTService, clientID, filename, h.privileged(context, clientID, filename))
+	if !ok {
 		return
 	}
+	serveImage(context, h.ImageService, clientID, filename, privileged, cache)
+}
 
-	// Extract JWT Token
+func (h imageController) GetImageVariant(context *gin.Context) {
+	clientID := context.Param("clientID")
+	filename := context.Param("filename")
+	preset := context.Param("preset")
+	if clientID == "" || filename == "" || preset == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID, filename or preset"})
+		return
+	}
+
+	filename, cache, ok := h.resolve(context, clientID, filename)
+	if !ok {
+		return
+	}
+	privileged, ok := moderationGate(context, h.ModerationService, h.JWTService, clientID, filename, h.privileged(context, clientID, filename))
+	if !ok {
+		return
+	}
+	serveVariant(context, h.ImageService, clientID, filename, preset, privileged, cache)
+}
+
+// resolve maps an "@alias" path segment to the image it points at. Alias
+// URLs change target, so they get a short cache lifetime while concrete
+// filenames stay immutable.
+func (h imageController) resolve(context *gin.Context, clientID, filename string) (string, func(*gin.Context, bool), bool) {
+	name, isAlias := strings.CutPrefix(filename, "@")
+	if !isAlias {
+		return filename, cacheHeaders, true
+	}
+
+	resolved, err := h.AliasService.Resolve(clientID, name)
+	if errors.Is(err, services.ErrAliasNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return "", nil, false
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	return resolved, shortCacheHeaders, true
+}
+
+// serveImage delivers an original or, when sizes are given in the query, an
+// ad-hoc rendition of it. Public requests get the watermarked image.
+func serveImage(context *gin.Context, imageService services.ImageService, clientID, filename string, privileged bool, cache func(*gin.Context, bool)) {
+	var resize in.ResizeRequest
+	if err := context.ShouldBindQuery(&resize); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resize parameters"})
+		return
+	}
+
+	var image *string
+	var err error
+	if resize.Width != 0 || resize.Height != 0 || resize.Fit != "" {
+		image, err = imageService.GetResizedImage(filename, clientID, resize, !privileged)
+	} else {
+		image, err = imageService.GetOriginalImage(filename, clientID, !privileged)
+	}
+	if errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrInvalidResize) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if unprocessable(err) {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cache(context, privileged)
+	contentHeaders(context, *image)
+
+	// Serve the file
+	context.File(*image)
+}
+
+// serveVariant delivers a preset rendition of an image
+func serveVariant(context *gin.Context, imageService services.ImageService, clientID, filename, preset string, privileged bool, cache func(*gin.Context, bool)) {
+	variant, err := imageService.GetImageVariant(filename, clientID, preset, !privileged)
+	if errors.Is(err, services.ErrImageNotFound) || errors.Is(err, services.ErrPresetNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if unprocessable(err) {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cache(context, privileged)
+	contentHeaders(context, *variant)
+
+	context.File(*variant)
+}
+
+func (h imageController) ListImages(context *gin.Context) {
 	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
 	if err != nil {
 		log.Error().Err(err).Msg("Invalid token")
@@ -67,40 +580,410 @@ func (h imageController) UploadImages(context *gin.Context) {
 		return
 	}
 
-	// Get multiple files from the form
-	form, _ := context.MultipartForm()
-	files := form.File["images"] // Get all uploaded images
-	log.Info().Msgf("Uploading %d images", len(files))
-	// If no images are uploaded
-	if len(files) == 0 {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+	images, err := h.ImageService.ListImages(token.ClientID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Call service to upload images
-	uploadedImages, err := h.ImageService.UploadImages(files, token.ClientID)
+	context.JSON(http.StatusOK, gin.H{"data": images})
+}
+
+func (h imageController) GetImageExif(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
 	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	clientID := context.Param("clientID")
+	filename := context.Param("filename")
+	if clientID != token.ClientID {
+		context.JSON(http.StatusForbidden, gin.H{"error": "EXIF data is only available to the image owner"})
+		return
+	}
+
+	exif, err := h.ImageService.GetImageExif(filename, clientID)
+	if errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Return uploaded images response
-	context.JSON(http.StatusCreated, gin.H{"data": uploadedImages})
+	context.JSON(http.StatusOK, gin.H{"data": exif})
 }
 
-func (h imageController) GetImage(context *gin.Context) {
+func (h imageController) GetImageMetadata(context *gin.Context) {
 	clientID := context.Param("clientID")
 	filename := context.Param("filename")
 	if clientID == "" || filename == "" {
 		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID or filename"})
 		return
 	}
-	image, err := h.ImageService.GetImage(filename, clientID)
+
+	// Authentication is optional here; it only unlocks the owner's EXIF fields
+	owner := false
+	if header := context.GetHeader(utils.Authorization); header != "" {
+		if token, err := h.JWTService.ExtractClaims(header); err == nil {
+			owner = token.ClientID == clientID
+		}
+	}
+	if _, ok := moderationGate(context, h.ModerationService, h.JWTService, clientID, filename, owner); !ok {
+		return
+	}
+
+	meta, err := h.ImageService.GetImageMetadata(filename, clientID, owner)
+	if errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": meta})
+}
+
+func (h imageController) BackfillMetadata(context *gin.Context) {
+	result, err := h.ImageService.BackfillMetadata()
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+func (h imageController) SetImageFocus(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	clientID := context.Param("clientID")
+	if clientID != token.ClientID {
+		context.JSON(http.StatusForbidden, gin.H{"error": "Only the image owner can change its focus"})
+		return
+	}
+
+	var request in.FocusRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	meta, err := h.ImageService.SetImageFocus(context.Param("filename"), clientID, request)
+	if errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrInvalidFocus) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": meta})
+}
+
+func (h imageController) ClearImageFocus(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	clientID := context.Param("clientID")
+	if clientID != token.ClientID {
+		context.JSON(http.StatusForbidden, gin.H{"error": "Only the image owner can change its focus"})
+		return
+	}
+
+	err = h.ImageService.ClearImageFocus(context.Param("filename"), clientID)
+	if errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+// DeleteImage removes one of the caller's images together with its records
+// and renditions
+func (h imageController) DeleteImage(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	clientID := context.Param("clientID")
+	if clientID != token.ClientID {
+		context.JSON(http.StatusForbidden, gin.H{"error": "Only the image owner can delete it"})
+		return
+	}
+
+	filename := context.Param("filename")
+	if _, failed := h.ImageService.DeleteImages(clientID, []string{filename}); len(failed) > 0 {
+		context.JSON(http.StatusNotFound, gin.H{"error": services.ErrImageNotFound.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func (h imageController) SignImageURL(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	clientID := context.Param("clientID")
+	filename := context.Param("filename")
+	if clientID != token.ClientID {
+		context.JSON(http.StatusForbidden, gin.H{"error": "Only the image owner can sign its URLs"})
+		return
+	}
+
+	ttl := defaultSignedURLTTL
+	if raw := context.Query("ttl"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > maxSignedURLTTL {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a number of seconds up to 7 days"})
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	if _, err := h.ImageService.GetImage(filename, clientID); errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	path := signedPath(clientID, filename)
+	expiresAt := time.Now().Add(ttl)
+	signature := utils.SignURL(h.URLSigningSecret, path, expiresAt.Unix())
+
+	context.JSON(http.StatusOK, gin.H{"data": response.SignedURLResponse{
+		URL:       fmt.Sprintf("%s?expires=%d&signature=%s", path, expiresAt.Unix(), signature),
+		ExpiresAt: expiresAt,
+	}})
+}
+
+func (h imageController) FindDuplicates(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	clientID := context.Param("clientID")
+	if clientID != token.ClientID {
+		context.JSON(http.StatusForbidden, gin.H{"error": "Only the image owner can search its duplicates"})
+		return
+	}
+
+	var request in.DuplicateRequest
+	if err := context.ShouldBindQuery(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid distance"})
+		return
+	}
+
+	duplicates, err := h.ImageService.FindDuplicates(context.Param("filename"), clientID, request)
+	h.respondDuplicates(context, duplicates, err)
+}
+
+func (h imageController) FindDuplicatesOf(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
 	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var request in.DuplicateRequest
+	if err := context.ShouldBindQuery(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid distance"})
+		return
+	}
+
+	limits := h.UploadLimits
+	limits.MaxFiles = 1
+	form, ok := h.streamUpload(context, "image", h.ImageService.StagingDir(token.ClientID, imaging.ScopeAsset), limits)
+	if !ok {
+		return
+	}
+	defer form.Cleanup()
+
+	duplicates, err := h.ImageService.FindDuplicatesOf(form.Files[0], token.ClientID, request)
+	h.respondDuplicates(context, duplicates, err)
+}
+
+func (h imageController) respondDuplicates(context *gin.Context, duplicates []response.DuplicateResponse, err error) {
+	if errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrInvalidDistance) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if unprocessable(err) {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	context.JSON(http.StatusOK, gin.H{"data": duplicates})
+}
+
+// privileged reports whether a delivery request may see the image without a
+// watermark: it carries either the owner's token or a valid signed URL
+func (h imageController) privileged(context *gin.Context, clientID, filename string) bool {
+	if signature := context.Query("signature"); signature != "" {
+		return utils.VerifyURL(h.URLSigningSecret, signedPath(clientID, filename), context.Query("expires"), signature)
+	}
+	if header := context.GetHeader(utils.Authorization); header != "" {
+		if token, err := h.JWTService.ExtractClaims(header); err == nil {
+			return token.ClientID == clientID
+		}
+	}
+	return false
+}
+
+// moderationGate hides images that are not approved from everyone but their
+// owner and admins, answering as if they did not exist. Those who may see
+// them are served privileged responses, which never land in shared caches.
+// It returns the privilege to serve with and whether to serve at all.
+func moderationGate(context *gin.Context, moderationService services.ModerationService, jwtService utils.JWTService, clientID, filename string, privileged bool) (bool, bool) {
+	state, err := moderationService.State(clientID, filename)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false, false
+	}
+	if state == "" || state == metadata.ModerationApproved {
+		return privileged, true
+	}
+
+	if header := context.GetHeader(utils.Authorization); header != "" {
+		if token, err := jwtService.ExtractClaims(header); err == nil && token.ClientID == clientID {
+			return true, true
+		}
+		if _, err := jwtService.ValidateTokenAdmin(header); err == nil {
+			return true, true
+		}
+	}
+	context.JSON(http.StatusNotFound, gin.H{"error": services.ErrImageNotFound.Error()})
+	return false, false
+}
+
+// signedPath is the resource a signed URL grants access to. The signature
+// covers the image, so it also unlocks its presets and resized renditions.
+func signedPath(clientID, filename string) string {
+	return fmt.Sprintf("/cdn/%s/%s", clientID, filename)
+}
+
+// cacheHeaders sets the caching policy of a delivered image. Unwatermarked
+// renditions served to privileged requests must not land in shared caches.
+func cacheHeaders(context *gin.Context, privileged bool) {
+	if privileged {
+		context.Header("Cache-Control", "private, max-age=3600")
+		context.Header("Vary", "Authorization")
+		return
+	}
+	context.Header("Cache-Control", "public, max-age=86400") // Cache for 1 day
+}
+
+// shortCacheHeaders is the caching policy of URLs whose target changes, such
+// as aliases and the current profile photo, so caches pick up changes quickly
+func shortCacheHeaders(context *gin.Context, privileged bool) {
+	if privileged {
+		context.Header("Cache-Control", "private, max-age=60")
+		context.Header("Vary", "Authorization")
+		return
+	}
+	context.Header("Cache-Control", "public, max-age=60")
+}
+
+// unprocessable reports whether err means the image itself cannot be
+// processed: it is corrupt, too large to decode safely or too slow to handle
+func unprocessable(err error) bool {
+	return errors.Is(err, imaging.ErrInvalidImage) || errors.Is(err, imaging.ErrImageTooLarge) ||
+		errors.Is(err, imaging.ErrProcessingTimeout) || errors.Is(err, services.ErrInfectedFile)
+}
+
+// checksumFailed answers a request whose checksums are malformed or do not
+// match the bytes received. Mismatching requests were likely corrupted on
+// the way, so they are flagged to be retried under the same Idempotency-Key.
+func checksumFailed(context *gin.Context, err error) bool {
+	if errors.Is(err, utils.ErrChecksumMismatch) {
+		context.Set(utils.ChecksumMismatch, true)
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	} else if errors.Is(err, utils.ErrInvalidChecksum) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// uploadScope returns the scope of the presigned upload token the request was
+// authenticated with, or nil for a user token
+func uploadScope(context *gin.Context) *uploadtoken.Scope {
+	if value, ok := context.Get(utils.UploadScope); ok {
+		return value.(*uploadtoken.Scope)
+	}
+	return nil
+}
+
+// scopedLimits narrows the upload limits to those of a presigned upload token
+func scopedLimits(limits utils.UploadLimits, scope *uploadtoken.Scope) utils.UploadLimits {
+	if scope == nil {
+		return limits
+	}
+	if limits.MaxFileSize == 0 || scope.MaxSize < limits.MaxFileSize {
+		limits.MaxFileSize = scope.MaxSize
+	}
+	if limits.MaxFiles == 0 || scope.MaxCount < limits.MaxFiles {
+		limits.MaxFiles = scope.MaxCount
+	}
+	return limits
+}
+
+// jsonUploadOptions takes the upload options of a validated JSON upload
+func jsonUploadOptions(request in.ImageRequest) in.UploadOptions {
+	return in.UploadOptions{
+		PreserveMetadata: request.PreserveMetadata,
+		Duplicates:       request.Duplicates,
+		FocalX:           request.FocalX,
+		FocalY:           request.FocalY,
+	}
+}
+
+// fraction reports whether an optional value lies within 0..1
+func fraction(value *float64) bool {
+	return value == nil || (*value >= 0 && *value <= 1)
+}
+
+// contentType derives the response content type from a file name
+func contentType(filename string) string {
 	contentType := "application/octet-stream"
 	if strings.HasSuffix(filename, ".png") {
 		contentType = "image/png"
@@ -108,12 +991,64 @@ func (h imageController) GetImage(context *gin.Context) {
 		contentType = "image/jpeg"
 	} else if strings.HasSuffix(filename, ".webp") {
 		contentType = "image/webp"
+	} else if strings.HasSuffix(filename, ".gif") {
+		contentType = "image/gif"
+	} else if strings.HasSuffix(filename, ".svg") {
+		contentType = "image/svg+xml"
 	}
+	return contentType
+}
 
-	// Set cache headers for faster performance
-	context.Header("Cache-Control", "public, max-age=86400") // Cache for 1 day
+// contentHeaders sets the content type of a delivered file. SVGs are
+// sanitized on upload; the policy additionally stops a browser from running
+// or loading anything should it be opened directly.
+func contentHeaders(context *gin.Context, filename string) {
+	contentType := contentType(filename)
 	context.Header("Content-Type", contentType)
+	if contentType == "image/svg+xml" {
+		context.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	}
+}
 
-	// Serve the file
-	context.File(*image)
+// uploadOptions reads the optional upload flags from the multipart form
+func uploadOptions(value func(string) string) (in.UploadOptions, error) {
+	preserve, err := formBool(value, "preserve_metadata")
+	if err != nil {
+		return in.UploadOptions{}, err
+	}
+	duplicates := value("duplicates")
+	if duplicates != "" && duplicates != in.DuplicatesReject && duplicates != in.DuplicatesLink {
+		return in.UploadOptions{}, errors.New("duplicates must be reject or link")
+	}
+	atomic, err := formBool(value, "atomic")
+	if err != nil {
+		return in.UploadOptions{}, err
+	}
+	options := in.UploadOptions{PreserveMetadata: preserve, Duplicates: duplicates, Atomic: atomic}
+
+	// Focal point of profile photos
+	focalX, focalY := value("focal_x"), value("focal_y")
+	if focalX == "" && focalY == "" {
+		return options, nil
+	}
+	x, errX := strconv.ParseFloat(focalX, 64)
+	y, errY := strconv.ParseFloat(focalY, 64)
+	if errX != nil || errY != nil || x < 0 || x > 1 || y < 0 || y > 1 {
+		return in.UploadOptions{}, errors.New("focal_x and focal_y must both be fractions between 0 and 1")
+	}
+	options.FocalX, options.FocalY = &x, &y
+	return options, nil
+}
+
+// formBool parses an optional boolean form field, false when it is absent
+func formBool(value func(string) string, name string) (bool, error) {
+	raw := value(name)
+	if raw == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return parsed, nil
 }
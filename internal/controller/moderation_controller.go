@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"cdn-service/internal/dto/in"
+	response "cdn-service/internal/dto/out"
+	"cdn-service/internal/services"
+	"cdn-service/internal/utils"
+	"cdn-service/models/metadata"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const (
+	defaultModerationLimit = 50
+	maxModerationLimit     = 500
+)
+
+type ModerationController interface {
+	ListModeration(context *gin.Context)
+	ApproveImage(context *gin.Context)
+	RejectImage(context *gin.Context)
+}
+
+type moderationController struct {
+	ModerationService services.ModerationService
+	JWTService        utils.JWTService
+}
+
+func NewModerationController(moderationService services.ModerationService, jwtService utils.JWTService) ModerationController {
+	return moderationController{ModerationService: moderationService, JWTService: jwtService}
+}
+
+// ListModeration lists the images in a moderation state, pending by default,
+// the longest waiting first
+func (h moderationController) ListModeration(context *gin.Context) {
+	var query in.ModerationQuery
+	if err := context.ShouldBindQuery(&query); err != nil || query.Limit < 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state or limit"})
+		return
+	}
+	if query.State == "" {
+		query.State = metadata.ModerationPending
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultModerationLimit
+	}
+	query.Limit = min(query.Limit, maxModerationLimit)
+
+	items, err := h.ModerationService.List(query.State, query.Limit)
+	if errors.Is(err, services.ErrInvalidModerationState) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+func (h moderationController) ApproveImage(context *gin.Context) {
+	token, ok := utils.ExtractTokenClaims(context)
+	if !ok {
+		return
+	}
+
+	item, err := h.ModerationService.Approve(context.Param("clientID"), context.Param("filename"), reviewer(token))
+	h.respond(context, item, err)
+}
+
+func (h moderationController) RejectImage(context *gin.Context) {
+	token, ok := utils.ExtractTokenClaims(context)
+	if !ok {
+		return
+	}
+
+	// The reason is optional
+	var request in.ModerationRequest
+	if context.Request.ContentLength != 0 {
+		if err := context.ShouldBindJSON(&request); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	item, err := h.ModerationService.Reject(context.Param("clientID"), context.Param("filename"), reviewer(token), request.Reason)
+	h.respond(context, item, err)
+}
+
+func (h moderationController) respond(context *gin.Context, item response.ModerationResponse, err error) {
+	if errors.Is(err, services.ErrModerationNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": item})
+}
+
+// reviewer identifies the admin deciding on an image in its record
+func reviewer(token *utils.TokenClaims) string {
+	return fmt.Sprintf("user:%d", token.UserID)
+}
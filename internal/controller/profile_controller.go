@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"cdn-service/internal/services"
+	"cdn-service/internal/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+type ProfileController interface {
+	GetCurrentProfile(context *gin.Context)
+	GetCurrentProfileVariant(context *gin.Context)
+	GetProfileHistory(context *gin.Context)
+	RestoreProfilePhoto(context *gin.Context)
+	PurgeProfileHistory(context *gin.Context)
+}
+
+type profileController struct {
+	ProfileService    services.ProfileService
+	ImageService      services.ImageService
+	ModerationService services.ModerationService
+	JWTService        utils.JWTService
+}
+
+func NewProfileController(profileService services.ProfileService, imageService services.ImageService, moderationService services.ModerationService, jwtService utils.JWTService) ProfileController {
+	return profileController{ProfileService: profileService, ImageService: imageService, ModerationService: moderationService, JWTService: jwtService}
+}
+
+// GetCurrentProfile serves the current profile photo under a URL that stays
+// the same when the photo changes
+func (h profileController) GetCurrentProfile(context *gin.Context) {
+	clientID := context.Param("clientID")
+	filename, ok := h.current(context, clientID)
+	if !ok {
+		return
+	}
+	privileged, ok := moderationGate(context, h.ModerationService, h.JWTService, clientID, filename, h.owner(context, clientID))
+	if !ok {
+		return
+	}
+	serveImage(context, h.ImageService, clientID, filename, privileged, shortCacheHeaders)
+}
+
+// GetCurrentProfileVariant serves a preset of the current profile photo
+func (h profileController) GetCurrentProfileVariant(context *gin.Context) {
+	clientID := context.Param("clientID")
+	filename, ok := h.current(context, clientID)
+	if !ok {
+		return
+	}
+	privileged, ok := moderationGate(context, h.ModerationService, h.JWTService, clientID, filename, h.owner(context, clientID))
+	if !ok {
+		return
+	}
+	serveVariant(context, h.ImageService, clientID, filename, context.Param("preset"), privileged, shortCacheHeaders)
+}
+
+func (h profileController) GetProfileHistory(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	history, err := h.ProfileService.ListHistory(token.ClientID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": history})
+}
+
+func (h profileController) RestoreProfilePhoto(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	history, err := h.ProfileService.Restore(token.ClientID, context.Param("filename"))
+	if errors.Is(err, services.ErrImageNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": history})
+}
+
+func (h profileController) PurgeProfileHistory(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	deleted, err := h.ProfileService.PurgeHistory(token.ClientID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": gin.H{"deleted": deleted}})
+}
+
+// current resolves the client's current profile photo, answering the request
+// itself when there is none
+func (h profileController) current(context *gin.Context, clientID string) (string, bool) {
+	filename, _, err := h.ProfileService.Current(clientID)
+	if errors.Is(err, services.ErrNoProfilePhoto) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return "", false
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return filename, true
+}
+
+// owner reports whether the request carries the client's own token, which
+// bypasses the watermark
+func (h profileController) owner(context *gin.Context, clientID string) bool {
+	if header := context.GetHeader(utils.Authorization); header != "" {
+		if token, err := h.JWTService.ExtractClaims(header); err == nil {
+			return token.ClientID == clientID
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"cdn-service/internal/dto/in"
+	"cdn-service/internal/services"
+	"cdn-service/internal/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+type UploadTokenController interface {
+	MintUploadToken(context *gin.Context)
+}
+
+type uploadTokenController struct {
+	UploadTokenService services.UploadTokenService
+	JWTService         utils.JWTService
+}
+
+func NewUploadTokenController(uploadTokenService services.UploadTokenService, jwtService utils.JWTService) UploadTokenController {
+	return uploadTokenController{UploadTokenService: uploadTokenService, JWTService: jwtService}
+}
+
+// MintUploadToken issues a presigned upload token for the caller's client
+func (h uploadTokenController) MintUploadToken(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var request in.UploadTokenRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	uploadToken, err := h.UploadTokenService.Mint(token.ClientID, request)
+	if errors.Is(err, services.ErrInvalidUploadScope) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusCreated, gin.H{"data": uploadToken})
+}
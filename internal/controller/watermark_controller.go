@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"cdn-service/internal/dto/in"
+	"cdn-service/internal/services"
+	"cdn-service/internal/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+type WatermarkController interface {
+	SetWatermark(context *gin.Context)
+	GetWatermark(context *gin.Context)
+	DeleteWatermark(context *gin.Context)
+}
+
+type watermarkController struct {
+	WatermarkService services.WatermarkService
+	JWTService       utils.JWTService
+	UploadLimits     utils.UploadLimits
+}
+
+func NewWatermarkController(watermarkService services.WatermarkService, jwtService utils.JWTService, uploadLimits utils.UploadLimits) WatermarkController {
+	return watermarkController{WatermarkService: watermarkService, JWTService: jwtService, UploadLimits: uploadLimits}
+}
+
+func (h watermarkController) SetWatermark(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var request in.WatermarkRequest
+	var overlay *in.UploadFile
+	if context.ContentType() == binding.MIMEMultipartPOSTForm {
+		// The overlay is streamed within the upload limits; it is optional
+		// when only the settings change
+		limits := h.UploadLimits
+		limits.MaxFiles = 1
+		form, ok := streamForm(context, "image", h.WatermarkService.StagingDir(), limits)
+		if !ok {
+			return
+		}
+		defer form.Cleanup()
+
+		if err := binding.MapFormWithTag(&request, form.Values, "form"); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if len(form.Files) > 0 {
+			overlay = &form.Files[0]
+		}
+	} else if err := context.ShouldBind(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	watermark, err := h.WatermarkService.SetWatermark(token.ClientID, overlay, request)
+	if errors.Is(err, services.ErrInvalidWatermark) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if unprocessable(err) {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": watermark})
+}
+
+func (h watermarkController) GetWatermark(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	watermark, err := h.WatermarkService.GetWatermark(token.ClientID)
+	if errors.Is(err, services.ErrWatermarkNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": watermark})
+}
+
+func (h watermarkController) DeleteWatermark(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	err = h.WatermarkService.DeleteWatermark(token.ClientID)
+	if errors.Is(err, services.ErrWatermarkNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"cdn-service/internal/dto/in"
+	"cdn-service/internal/services"
+	"cdn-service/internal/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+type WebhookController interface {
+	RegisterWebhook(context *gin.Context)
+	UpdateWebhook(context *gin.Context)
+	GetWebhooks(context *gin.Context)
+	DeleteWebhook(context *gin.Context)
+	GetDeliveries(context *gin.Context)
+	Redeliver(context *gin.Context)
+}
+
+type webhookController struct {
+	WebhookService services.WebhookService
+	JWTService     utils.JWTService
+}
+
+func NewWebhookController(webhookService services.WebhookService, jwtService utils.JWTService) WebhookController {
+	return webhookController{WebhookService: webhookService, JWTService: jwtService}
+}
+
+func (h webhookController) RegisterWebhook(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var request in.WebhookRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	webhook, err := h.WebhookService.RegisterWebhook(token.ClientID, request)
+	if err != nil {
+		h.handleError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusCreated, gin.H{"data": webhook})
+}
+
+func (h webhookController) UpdateWebhook(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var request in.WebhookRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	webhook, err := h.WebhookService.UpdateWebhook(token.ClientID, context.Param("webhookID"), request)
+	if err != nil {
+		h.handleError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": webhook})
+}
+
+func (h webhookController) GetWebhooks(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	webhooks, err := h.WebhookService.GetWebhooks(token.ClientID)
+	if err != nil {
+		h.handleError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": webhooks})
+}
+
+func (h webhookController) DeleteWebhook(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	if err := h.WebhookService.DeleteWebhook(token.ClientID, context.Param("webhookID")); err != nil {
+		h.handleError(context, err)
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func (h webhookController) GetDeliveries(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	deliveries, err := h.WebhookService.GetDeliveries(token.ClientID, context.Param("webhookID"))
+	if err != nil {
+		h.handleError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"data": deliveries})
+}
+
+func (h webhookController) Redeliver(context *gin.Context) {
+	token, err := h.JWTService.ExtractClaims(context.GetHeader(utils.Authorization))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token")
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	delivery, err := h.WebhookService.Redeliver(token.ClientID, context.Param("webhookID"), context.Param("deliveryID"))
+	if err != nil {
+		h.handleError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusAccepted, gin.H{"data": delivery})
+}
+
+func (h webhookController) handleError(context *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrDeliveryNotFound):
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidWebhook):
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Error().Err(err).Msg("Webhook operation failed")
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
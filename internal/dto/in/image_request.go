@@ -1,6 +1,51 @@
 package in
 
-// ImageRequest ...
+// ImageRequest is the body of the JSON upload endpoints. Image is streamed to
+// a staging file while the body is read and is always empty once decoded.
 type ImageRequest struct {
-	Image string `json:"image"`
+	Image            string   `json:"image"`    // Standard base64 or a base64 data URI
+	Filename         string   `json:"filename"` // Optional, the stored name is generated either way
+	PreserveMetadata bool     `json:"preserve_metadata"`
+	Duplicates       string   `json:"duplicates"`
+	FocalX           *float64 `json:"focal_x"` // Profile photos only
+	FocalY           *float64 `json:"focal_y"`
+	SHA256           string   `json:"sha256"` // Optional hex digest of the decoded image
+}
+
+// FocusRequest sets the focal point and/or crop rectangle of an image. All
+// values are fractions (0-1) of the image width and height.
+type FocusRequest struct {
+	FocalX *float64     `json:"focal_x"`
+	FocalY *float64     `json:"focal_y"`
+	Crop   *CropRequest `json:"crop"`
+}
+
+type CropRequest struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width" binding:"required"`
+	Height float64 `json:"height" binding:"required"`
+}
+
+// ResizeRequest holds the ad-hoc resize query parameters of the CDN route
+type ResizeRequest struct {
+	Width  int    `form:"w"`
+	Height int    `form:"h"`
+	Fit    string `form:"fit"`
+}
+
+// AliasRequest points an alias at a stored image
+type AliasRequest struct {
+	Filename string `json:"filename" binding:"required"`
+}
+
+// ModerationRequest is an admin decision on a moderated image
+type ModerationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ModerationQuery filters the moderation queue
+type ModerationQuery struct {
+	State string `form:"state"` // Defaults to pending
+	Limit int    `form:"limit"`
 }
@@ -0,0 +1,49 @@
+package in
+
+const (
+	DuplicatesReject = "reject" // Refuse uploads that nearly match a stored image
+	DuplicatesLink   = "link"   // Return the stored image instead of saving the upload
+)
+
+// UploadOptions carries the per-request options of the upload endpoints
+type UploadOptions struct {
+	PreserveMetadata bool     // Keep EXIF/XMP and the original orientation untouched
+	Duplicates       string   // Empty to always store, or DuplicatesReject / DuplicatesLink
+	Atomic           bool     // Batch uploads: remove every stored file when one fails
+	FocalX           *float64 // Profile photos only: point to crop the square around,
+	FocalY           *float64 // as fractions of the upright photo
+	AllowedFormats   []string // Presigned uploads: formats accepted, empty for any
+	ImagesOnly       bool     // Presigned uploads: refuse files in no known format
+}
+
+// URLUploadRequest imports an image from a remote URL
+type URLUploadRequest struct {
+	URL              string `json:"url" binding:"required"`
+	Filename         string `json:"filename"` // Defaults to the last segment of the URL path
+	PreserveMetadata bool   `json:"preserve_metadata"`
+	Duplicates       string `json:"duplicates"`
+}
+
+// UploadFile is an uploaded file that was streamed to a staging file
+type UploadFile struct {
+	Filename    string // Base name sent by the client
+	Path        string // Staging file, moved or removed once the upload is handled
+	Size        int64
+	SHA256      string // Hex digest computed while streaming
+	ContentType string // Sniffed from the leading bytes
+}
+
+// DuplicateRequest holds the query of the near-duplicate endpoints
+type DuplicateRequest struct {
+	Distance *int `form:"distance"` // Maximum Hamming distance between hashes, 0-64
+}
+
+// UploadTokenRequest scopes a presigned upload token. Zero values take the
+// server's defaults.
+type UploadTokenRequest struct {
+	MaxSize      int64    `json:"max_size"`      // Bytes per file, at most MAX_UPLOAD_FILE_SIZE
+	AllowedTypes []string `json:"allowed_types"` // MIME types such as image/png
+	MaxCount     int      `json:"max_count"`     // Files over the token's lifetime, 1 by default
+	Alias        string   `json:"alias"`         // Alias pointed at each stored upload
+	TTL          int      `json:"ttl"`           // Seconds
+}
@@ -0,0 +1,9 @@
+package in
+
+// WatermarkRequest holds the settings fields of the watermark form
+type WatermarkRequest struct {
+	Position string   `form:"position"` // top-left, top-right, bottom-left, bottom-right or center
+	Opacity  *float64 `form:"opacity"`  // 0-1, defaults to 0.5
+	Scale    *float64 `form:"scale"`    // Overlay width as a fraction of the image width, defaults to 0.25
+	MinSize  *int     `form:"min_size"` // Smaller renditions are not watermarked, defaults to 200
+}
@@ -0,0 +1,9 @@
+package in
+
+// WebhookRequest is the payload for registering or updating a webhook
+type WebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Secret string   `json:"secret"` // Generated when empty
+	Events []string `json:"events"` // Empty subscribes to every event
+	Active *bool    `json:"active"`
+}
@@ -4,8 +4,139 @@ import "time"
 
 // ImageResponse represents the response data for uploaded images
 type ImageResponse struct {
-	ImageURL   string    `json:"image_url"`   // URL or file path of the uploaded image
-	FileType   string    `json:"file_type"`   // Image format (jpg, png, etc.)
-	FileSize   int64     `json:"file_size"`   // Image size in bytes
-	UploadedAt time.Time `json:"uploaded_at"` // Timestamp of upload
+	ImageURL    string            `json:"image_url"`             // URL or file path of the uploaded image
+	FileType    string            `json:"file_type"`             // Image format (jpg, png, etc.)
+	FileSize    int64             `json:"file_size"`             // Image size in bytes
+	UploadedAt  time.Time         `json:"uploaded_at"`           // Timestamp of upload
+	Variants    map[string]string `json:"variants,omitempty"`    // Preset name to rendition URL
+	BlurHash    string            `json:"blurhash,omitempty"`    // BlurHash placeholder string
+	Placeholder string            `json:"placeholder,omitempty"` // Tiny base64 data URI preview
+	Duplicate   bool              `json:"duplicate,omitempty"`   // The upload matched this stored image and was not saved
+	Moderation  string            `json:"moderation,omitempty"`  // Review state when moderation is enabled
+	SHA256      string            `json:"sha256,omitempty"`      // Hex digest of the bytes received, only in upload responses
+}
+
+const (
+	UploadCreated    = "created"     // Stored under a new URL
+	UploadDuplicate  = "duplicate"   // Answered with a stored near-duplicate
+	UploadFailed     = "failed"      // See Error and Message
+	UploadRolledBack = "rolled_back" // Stored, then removed because an atomic batch failed
+	UploadSkipped    = "skipped"     // Not processed because an atomic batch had already failed
+)
+
+// UploadResult is the outcome of one file of a batch upload
+type UploadResult struct {
+	Index    int            `json:"index"`    // Position of the file in the request
+	Filename string         `json:"filename"` // Name sent by the client
+	Status   string         `json:"status"`
+	Image    *ImageResponse `json:"image,omitempty"`
+	Error    string         `json:"error,omitempty"` // Machine readable code, e.g. invalid_image
+	Message  string         `json:"message,omitempty"`
+}
+
+// DuplicateResponse is a stored image that nearly matches another one
+type DuplicateResponse struct {
+	ImageURL   string    `json:"image_url"`
+	Distance   int       `json:"distance"` // Hamming distance between the perceptual hashes
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// ImageExifResponse exposes the EXIF fields captured at upload to the owner
+type ImageExifResponse struct {
+	Filename    string            `json:"filename"`
+	Orientation int               `json:"orientation"`
+	Stripped    bool              `json:"stripped"` // Whether the metadata was removed from the served file
+	Fields      map[string]string `json:"fields"`
+	ExtractedAt time.Time         `json:"extracted_at"`
+}
+
+// ImageMetadataResponse describes a stored image without downloading it
+type ImageMetadataResponse struct {
+	ImageURL       string            `json:"image_url"`
+	Format         string            `json:"format"`
+	Width          int               `json:"width"`
+	Height         int               `json:"height"`
+	FileSize       int64             `json:"file_size"`
+	Checksum       string            `json:"checksum"`
+	DominantColors []string          `json:"dominant_colors"`
+	HasAlpha       bool              `json:"has_alpha"`
+	Animated       bool              `json:"animated"`
+	FrameCount     int               `json:"frame_count"`
+	DurationMs     int64             `json:"duration_ms"` // Play time of one loop, 0 for still images
+	BlurHash       string            `json:"blurhash,omitempty"`
+	Placeholder    string            `json:"placeholder,omitempty"`
+	PHash          string            `json:"phash,omitempty"`
+	ICCProfile     string            `json:"icc_profile,omitempty"`
+	NonSRGB        bool              `json:"non_srgb"` // Renditions were converted to sRGB
+	FocalPoint     *FocusPoint       `json:"focal_point,omitempty"`
+	CropRect       *FocusRect        `json:"crop_rect,omitempty"`
+	UploadedAt     time.Time         `json:"uploaded_at"`
+	Exif           map[string]string `json:"exif,omitempty"` // Only returned to the owner
+}
+
+// FocusPoint is a focal point as fractions of the image size
+type FocusPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// FocusRect is a crop rectangle as fractions of the image size
+type FocusRect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// BackfillResponse summarizes a metadata backfill run
+type BackfillResponse struct {
+	Scanned int `json:"scanned"`
+	Created int `json:"created"`
+	Failed  int `json:"failed"`
+}
+
+// ProfileHistoryResponse lists a client's retained profile photos
+type ProfileHistoryResponse struct {
+	CurrentURL string                 `json:"current_url"` // Stable URL of whichever photo is current
+	Photos     []ProfilePhotoResponse `json:"photos"`      // Newest first
+}
+
+// ProfilePhotoResponse is one retained profile photo
+type ProfilePhotoResponse struct {
+	ImageURL   string            `json:"image_url"`
+	Variants   map[string]string `json:"variants,omitempty"`
+	UploadedAt time.Time         `json:"uploaded_at"`
+	Current    bool              `json:"current"`
+}
+
+// AliasResponse is a named alias and the image it currently resolves to
+type AliasResponse struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`       // Stable URL, served with a short cache lifetime
+	ImageURL  string    `json:"image_url"` // Immutable URL of the current image
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UploadTokenResponse is a freshly minted presigned upload token and its scope
+type UploadTokenResponse struct {
+	Token        string    `json:"token"` // Sent as the Authorization header of the upload endpoints
+	ExpiresAt    time.Time `json:"expires_at"`
+	MaxSize      int64     `json:"max_size"`
+	AllowedTypes []string  `json:"allowed_types,omitempty"`
+	MaxCount     int       `json:"max_count"`
+	Alias        string    `json:"alias,omitempty"`
+}
+
+// ModerationResponse is the review state of an image
+type ModerationResponse struct {
+	ClientID      string             `json:"client_id"`
+	Filename      string             `json:"filename"`
+	ImageURL      string             `json:"image_url"`
+	State         string             `json:"state"`                    // pending, approved or rejected
+	PreviousState string             `json:"previous_state,omitempty"` // Only set in image.moderated events
+	Reason        string             `json:"reason,omitempty"`
+	Labels        map[string]float64 `json:"labels,omitempty"`
+	ReviewedBy    string             `json:"reviewed_by,omitempty"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
 }
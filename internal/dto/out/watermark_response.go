@@ -0,0 +1,18 @@
+package out
+
+import "time"
+
+// WatermarkResponse represents a client's watermark configuration
+type WatermarkResponse struct {
+	Position  string    `json:"position"`
+	Opacity   float64   `json:"opacity"`
+	Scale     float64   `json:"scale"`
+	MinSize   int       `json:"min_size"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SignedURLResponse is a time-limited URL that bypasses watermarking
+type SignedURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,103 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"time"
+)
+
+const (
+	paletteSampleSize = 64
+	paletteSize       = 5
+)
+
+// Analysis describes the intrinsic properties of an image file
+type Analysis struct {
+	Format         string
+	Width          int
+	Height         int
+	HasAlpha       bool
+	Animated       bool
+	FrameCount     int
+	Duration       time.Duration
+	DominantColors []string // Hex colours, most frequent first
+}
+
+// Analyze inspects an encoded image. img is its decoded first frame.
+func Analyze(data []byte, format string, img image.Image) (*Analysis, error) {
+	b := img.Bounds()
+	a := &Analysis{
+		Format:     format,
+		Width:      b.Dx(),
+		Height:     b.Dy(),
+		FrameCount: 1,
+	}
+
+	if format == FormatGIF || format == FormatWebP {
+		h, err := ReadHeader(data)
+		if err != nil {
+			return nil, err
+		}
+		a.FrameCount = h.Frames
+		a.Duration = h.Duration
+		a.Width, a.Height = h.Width, h.Height
+	}
+	a.Animated = a.FrameCount > 1
+
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		a.HasAlpha = !o.Opaque()
+	}
+	a.DominantColors = DominantColors(img, paletteSize)
+	return a, nil
+}
+
+// DominantColors returns up to n of the most frequent colours of img. Colours
+// are bucketed to 4 bits per channel and each bucket reports its mean colour.
+// Mostly transparent pixels are ignored.
+func DominantColors(img image.Image, n int) []string {
+	sample := toNRGBA(Resize(img, paletteSampleSize, paletteSampleSize, FitContain))
+
+	type bucket struct {
+		key     int
+		count   int
+		r, g, b int
+	}
+	buckets := map[int]*bucket{}
+	for i := 0; i+3 < len(sample.Pix); i += 4 {
+		if sample.Pix[i+3] < 128 {
+			continue
+		}
+		r, g, b := int(sample.Pix[i]), int(sample.Pix[i+1]), int(sample.Pix[i+2])
+		key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+		bk, ok := buckets[key]
+		if !ok {
+			bk = &bucket{key: key}
+			buckets[key] = bk
+		}
+		bk.count++
+		bk.r += r
+		bk.g += g
+		bk.b += b
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].key < sorted[j].key
+	})
+
+	colors := make([]string, 0, n)
+	for _, bk := range sorted {
+		if len(colors) == n {
+			break
+		}
+		colors = append(colors, fmt.Sprintf("#%02x%02x%02x", bk.r/bk.count, bk.g/bk.count, bk.b/bk.count))
+	}
+	return colors
+}
@@ -0,0 +1,156 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+
+	"golang.org/x/image/draw"
+)
+
+// DecodeAnimation decodes every frame of a GIF after checking its header
+// against the configured limits
+func DecodeAnimation(data []byte) (*gif.GIF, error) {
+	if _, err := CheckLimits(data); err != nil {
+		return nil, err
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return g, nil
+}
+
+// ResizeAnimation resizes every frame of an animation the same way, applying
+// the watermark if one is given. Frames are first composited onto the full
+// canvas, so disposal methods and partial frames render as they did in the
+// source; every output frame then covers the whole canvas. Frames are
+// composited and resized one at a time, so only the running canvas is kept
+// at full size. Smart cropping is disabled as it would pick a different
+// window per frame. Every frame is quantized to the palette of the whole
+// animation, as it may show colours left on the canvas by earlier frames.
+func ResizeAnimation(g *gif.GIF, width, height int, fit string, hint CropHint, wm *Watermark) *gif.GIF {
+	hint.NoSmart = true
+	canvas := newCompositor(g)
+	palette := animationPalette(g)
+
+	out := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(g.Image)),
+		Delay:     append([]int(nil), g.Delay...),
+		Disposal:  make([]byte, len(g.Image)),
+		LoopCount: g.LoopCount,
+	}
+	for i := range g.Image {
+		var img image.Image = canvas.draw(i)
+		if width != 0 || height != 0 {
+			img = ResizeWithHint(img, width, height, fit, hint)
+		}
+		if wm != nil {
+			img = ApplyWatermark(img, *wm)
+		}
+
+		b := img.Bounds()
+		paletted := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette)
+		draw.FloydSteinberg.Draw(paletted, paletted.Rect, img, b.Min)
+		out.Image = append(out.Image, paletted)
+		out.Disposal[i] = gif.DisposalNone
+
+		// The canvas may only change once the frame was quantized
+		canvas.dispose(i)
+	}
+	if len(out.Image) > 0 {
+		out.Config = image.Config{
+			ColorModel: out.Image[0].Palette,
+			Width:      out.Image[0].Rect.Dx(),
+			Height:     out.Image[0].Rect.Dy(),
+		}
+	}
+	return out
+}
+
+// EncodeAnimation writes an animation as GIF
+func EncodeAnimation(g *gif.GIF) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compositor renders what is on screen after each frame of an animation is
+// drawn, honouring the disposal methods between frames
+type compositor struct {
+	g        *gif.GIF
+	canvas   *image.NRGBA
+	previous *image.NRGBA // Canvas to restore after a DisposalPrevious frame
+}
+
+func newCompositor(g *gif.GIF) *compositor {
+	return &compositor{g: g, canvas: image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))}
+}
+
+// draw composites frame i and returns the canvas, which stays valid until
+// dispose is called
+func (c *compositor) draw(i int) *image.NRGBA {
+	if c.disposal(i) == gif.DisposalPrevious {
+		if c.previous == nil {
+			c.previous = image.NewNRGBA(c.canvas.Rect)
+		}
+		copy(c.previous.Pix, c.canvas.Pix)
+	}
+	frame := c.g.Image[i]
+	draw.Draw(c.canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	return c.canvas
+}
+
+// dispose clears frame i as its disposal method asks, before the next frame
+// is drawn
+func (c *compositor) dispose(i int) {
+	switch c.disposal(i) {
+	case gif.DisposalBackground:
+		draw.Draw(c.canvas, c.g.Image[i].Bounds(), image.Transparent, image.Point{}, draw.Src)
+	case gif.DisposalPrevious:
+		c.canvas, c.previous = c.previous, c.canvas
+	}
+}
+
+func (c *compositor) disposal(i int) byte {
+	if i < len(c.g.Disposal) {
+		return c.g.Disposal[i]
+	}
+	return 0
+}
+
+// animationPalette returns the colours of the global palette and of every
+// local palette of an animation, with a transparent entry for the cleared
+// canvas. When they do not fit in one palette, the web-safe colours are used
+// instead and frames rely on dithering.
+func animationPalette(g *gif.GIF) color.Palette {
+	palettes := make([]color.Palette, 0, len(g.Image)+1)
+	if global, ok := g.Config.ColorModel.(color.Palette); ok {
+		palettes = append(palettes, global)
+	}
+	for _, frame := range g.Image {
+		palettes = append(palettes, frame.Palette)
+	}
+
+	combined := color.Palette{color.Transparent}
+	seen := map[color.RGBA]bool{{}: true}
+	for _, p := range palettes {
+		for _, c := range p {
+			rgba := color.RGBAModel.Convert(c).(color.RGBA)
+			if seen[rgba] {
+				continue
+			}
+			seen[rgba] = true
+			combined = append(combined, rgba)
+		}
+	}
+	if len(combined) > 256 {
+		return append(color.Palette{color.Transparent}, palette.WebSafe...)
+	}
+	return combined
+}
@@ -0,0 +1,110 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{R: 0xff, A: 0xff}
+	green = color.RGBA{G: 0xff, A: 0xff}
+	blue  = color.RGBA{B: 0xff, A: 0xff}
+)
+
+// localPaletteGIF encodes a 4x4 animation whose frames each bring their own
+// palette: a red frame covering the canvas, then a blue frame over its left
+// half that leaves the red right half on screen
+func localPaletteGIF(t *testing.T) []byte {
+	t.Helper()
+	first := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{red, green})
+	draw.Draw(first, first.Rect, image.NewUniform(red), image.Point{}, draw.Src)
+	second := image.NewPaletted(image.Rect(0, 0, 2, 4), color.Palette{blue, green})
+	draw.Draw(second, second.Rect, image.NewUniform(blue), image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:    []*image.Paletted{first, second},
+		Delay:    []int{10, 10},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	})
+	if err != nil {
+		t.Fatalf("encode fixture: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestResizeAnimationKeepsCarriedOverColours(t *testing.T) {
+	source, err := gif.DecodeAll(bytes.NewReader(localPaletteGIF(t)))
+	if err != nil {
+		t.Fatalf("decode fixture: %v", err)
+	}
+	if len(source.Image[1].Palette) != 2 {
+		t.Fatalf("second frame has %d palette entries, want its own 2", len(source.Image[1].Palette))
+	}
+
+	encoded, err := EncodeAnimation(ResizeAnimation(source, 0, 0, FitContain, CropHint{}, nil))
+	if err != nil {
+		t.Fatalf("EncodeAnimation: %v", err)
+	}
+	out, err := gif.DecodeAll(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("decode rendition: %v", err)
+	}
+	if len(out.Image) != 2 {
+		t.Fatalf("got %d frames, want 2", len(out.Image))
+	}
+
+	frame := out.Image[1]
+	for _, tt := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{x: 0, y: 0, want: blue},
+		{x: 1, y: 3, want: blue},
+		{x: 2, y: 0, want: red},
+		{x: 3, y: 3, want: red},
+	} {
+		if got := color.RGBAModel.Convert(frame.At(tt.x, tt.y)); got != tt.want {
+			t.Errorf("second frame at %d,%d = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestAnimationPalette(t *testing.T) {
+	frame := func(palette color.Palette) *image.Paletted {
+		return image.NewPaletted(image.Rect(0, 0, 1, 1), palette)
+	}
+
+	g := &gif.GIF{
+		Image:  []*image.Paletted{frame(color.Palette{red, green}), frame(color.Palette{green, blue})},
+		Config: image.Config{ColorModel: color.Palette{red}},
+	}
+	got := animationPalette(g)
+	want := color.Palette{color.Transparent, red, green, blue}
+	if len(got) != len(want) {
+		t.Fatalf("palette = %v, want %v", got, want)
+	}
+	for i := range want {
+		if color.RGBAModel.Convert(got[i]) != color.RGBAModel.Convert(want[i]) {
+			t.Errorf("palette[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// Frames with more colours than a palette holds
+	var many []*image.Paletted
+	for i := 0; i < 3; i++ {
+		palette := make(color.Palette, 0, 200)
+		for j := 0; j < 200; j++ {
+			palette = append(palette, color.RGBA{R: uint8(i), G: uint8(j), A: 0xff})
+		}
+		many = append(many, frame(palette))
+	}
+	if got := animationPalette(&gif.GIF{Image: many}); len(got) > 256 {
+		t.Errorf("palette has %d entries, more than a GIF holds", len(got))
+	}
+}
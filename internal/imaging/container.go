@@ -0,0 +1,301 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/http"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatWebP = "webp"
+	FormatSVG  = "svg"
+)
+
+// DetectFormat sniffs the image format from the file's leading bytes
+func DetectFormat(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return FormatJPEG
+	case "image/png":
+		return FormatPNG
+	case "image/gif":
+		return FormatGIF
+	case "image/webp":
+		return FormatWebP
+	}
+	if IsSVG(data) {
+		return FormatSVG
+	}
+	return ""
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatPNG:
+		return "image/png"
+	case FormatGIF:
+		return "image/gif"
+	case FormatWebP:
+		return "image/webp"
+	case FormatSVG:
+		return "image/svg+xml"
+	}
+	return "application/octet-stream"
+}
+
+// FormatFromContentType returns the format of a MIME type, or "" when it is
+// not a supported image type
+func FormatFromContentType(contentType string) string {
+	for _, format := range []string{FormatJPEG, FormatPNG, FormatGIF, FormatWebP, FormatSVG} {
+		if ContentType(format) == contentType {
+			return format
+		}
+	}
+	return ""
+}
+
+// Extension returns the canonical file extension of a format
+func Extension(format string) string {
+	switch format {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatPNG:
+		return ".png"
+	case FormatGIF:
+		return ".gif"
+	case FormatWebP:
+		return ".webp"
+	case FormatSVG:
+		return ".svg"
+	}
+	return ""
+}
+
+var errMalformed = errors.New("malformed image container")
+
+type jpegSegment struct {
+	marker  byte
+	payload []byte
+	raw     []byte
+}
+
+// jpegSegments splits a JPEG into its header segments. The final segment is
+// the start-of-scan marker together with the entropy coded data and trailer.
+func jpegSegments(data []byte) ([]jpegSegment, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errMalformed
+	}
+
+	var segments []jpegSegment
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, errMalformed
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xDA {
+			segments = append(segments, jpegSegment{marker: marker, raw: data[pos:]})
+			return segments, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, errMalformed
+		}
+		segments = append(segments, jpegSegment{
+			marker:  marker,
+			payload: data[pos+4 : pos+2+length],
+			raw:     data[pos : pos+2+length],
+		})
+		pos += 2 + length
+	}
+	return nil, errMalformed
+}
+
+// isJPEGMetadata reports whether a segment carries descriptive metadata
+// (EXIF, XMP, IPTC or comments) rather than data needed for decoding.
+func isJPEGMetadata(seg jpegSegment) bool {
+	switch seg.marker {
+	case 0xE1, 0xED, 0xFE:
+		return true
+	}
+	return false
+}
+
+func isJPEGICC(seg jpegSegment) bool {
+	return seg.marker == 0xE2 && bytes.HasPrefix(seg.payload, []byte("ICC_PROFILE\x00"))
+}
+
+// StripJPEGMetadata drops EXIF, XMP, IPTC and comment segments without
+// re-encoding. Colour profiles are kept so the image renders identically.
+func StripJPEGMetadata(data []byte) ([]byte, error) {
+	segments, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	buf.Write([]byte{0xFF, 0xD8})
+	for _, seg := range segments {
+		if isJPEGMetadata(seg) {
+			continue
+		}
+		buf.Write(seg.raw)
+	}
+	return buf.Bytes(), nil
+}
+
+// copyJPEGICC inserts the ICC profile segments of src right after the SOI
+// marker of dst, so a re-encoded image keeps its colour profile.
+func copyJPEGICC(src, dst []byte) []byte {
+	segments, err := jpegSegments(src)
+	if err != nil || len(dst) < 2 {
+		return dst
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(dst))
+	buf.Write(dst[:2])
+	for _, seg := range segments {
+		if isJPEGICC(seg) {
+			buf.Write(seg.raw)
+		}
+	}
+	buf.Write(dst[2:])
+	return buf.Bytes()
+}
+
+type pngChunk struct {
+	kind string
+	data []byte
+	raw  []byte
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func pngChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errMalformed
+	}
+
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		chunk := pngChunk{
+			kind: string(data[pos+4 : pos+8]),
+			data: data[pos+8 : pos+8+length],
+			raw:  data[pos:end],
+		}
+		chunks = append(chunks, chunk)
+		pos = end
+		if chunk.kind == "IEND" {
+			return chunks, nil
+		}
+	}
+	return nil, errMalformed
+}
+
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// StripPNGMetadata drops EXIF, text and timestamp chunks without re-encoding
+func StripPNGMetadata(data []byte) ([]byte, error) {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	buf.Write(pngSignature)
+	for _, c := range chunks {
+		if pngMetadataChunks[c.kind] {
+			continue
+		}
+		buf.Write(c.raw)
+	}
+	return buf.Bytes(), nil
+}
+
+type webpChunk struct {
+	kind string
+	data []byte
+}
+
+func webpChunks(data []byte) ([]webpChunk, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+
+	var chunks []webpChunk
+	pos := 12
+	for pos+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size
+		if size < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		chunks = append(chunks, webpChunk{kind: string(data[pos : pos+4]), data: data[pos+8 : end]})
+		pos = end + size%2
+	}
+	return chunks, nil
+}
+
+// StripWebPMetadata drops the EXIF and XMP chunks of an extended WebP file
+// and clears the matching feature flags.
+func StripWebPMetadata(data []byte) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, c := range chunks {
+		if c.kind == "EXIF" || c.kind == "XMP " {
+			continue
+		}
+		payload := c.data
+		if c.kind == "VP8X" && len(payload) > 0 {
+			payload = append([]byte(nil), payload...)
+			payload[0] &^= 0x08 | 0x04
+		}
+		var header [8]byte
+		copy(header[:4], c.kind)
+		binary.LittleEndian.PutUint32(header[4:], uint32(len(payload)))
+		body.Write(header[:])
+		body.Write(payload)
+		if len(payload)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(body.Len()))
+	buf.Write(size[:])
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
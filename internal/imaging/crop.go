@@ -0,0 +1,187 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+const smartCropSampleSize = 128
+
+// CropHint tells cover resizing which part of the image matters. Fractions are
+// relative to the image size, with (0,0) the top-left corner.
+type CropHint struct {
+	Rect    *RectF  // Region to keep before resizing, for every fit
+	Focal   *PointF // Point to keep as central as possible when cropping
+	NoSmart bool    // Fall back to a centered crop instead of smart cropping
+}
+
+type PointF struct {
+	X, Y float64
+}
+
+type RectF struct {
+	X, Y, Width, Height float64
+}
+
+// ResizeWithHint is Resize that honours a crop hint. The hint's rectangle is
+// applied first; cover crops then follow the focal point, or the most detailed
+// region of the image when no focal point is set. Like contain, fill and
+// cover never upscale: a box larger than the source is shrunk to fit it,
+// keeping its aspect ratio.
+func ResizeWithHint(img image.Image, width, height int, fit string, hint CropHint) image.Image {
+	if hint.Rect != nil {
+		img = subImage(img, fractionRect(img.Bounds(), *hint.Rect))
+	}
+
+	if fit != FitCover || width <= 0 || height <= 0 {
+		if fit == FitFill && width > 0 && height > 0 {
+			width, height = shrinkToFit(img.Bounds(), width, height)
+		}
+		return Resize(img, width, height, fit)
+	}
+
+	b := img.Bounds()
+	var crop image.Rectangle
+	switch {
+	case hint.Focal != nil:
+		crop = FocalCrop(b, width, height, *hint.Focal)
+	case !hint.NoSmart:
+		crop = SmartCrop(img, width, height)
+	default:
+		crop = CoverCrop(b, width, height)
+	}
+	width, height = shrinkToFit(crop, width, height)
+	return scale(img, crop, width, height)
+}
+
+// shrinkToFit scales a width x height box down until it fits inside region
+func shrinkToFit(region image.Rectangle, width, height int) (int, int) {
+	ratio := math.Min(float64(region.Dx())/float64(width), float64(region.Dy())/float64(height))
+	if ratio >= 1 {
+		return width, height
+	}
+	return max(1, int(math.Round(float64(width)*ratio))), max(1, int(math.Round(float64(height)*ratio)))
+}
+
+// FocalCrop returns the largest region of bounds with the aspect ratio of
+// width x height, centered on the focal point as far as the edges allow.
+func FocalCrop(bounds image.Rectangle, width, height int, focal PointF) image.Rectangle {
+	crop := CoverCrop(bounds, width, height)
+	cw, ch := crop.Dx(), crop.Dy()
+
+	fx := bounds.Min.X + int(math.Round(clamp01(focal.X)*float64(bounds.Dx())))
+	fy := bounds.Min.Y + int(math.Round(clamp01(focal.Y)*float64(bounds.Dy())))
+
+	x := clampInt(fx-cw/2, bounds.Min.X, bounds.Max.X-cw)
+	y := clampInt(fy-ch/2, bounds.Min.Y, bounds.Max.Y-ch)
+	return image.Rect(x, y, x+cw, y+ch)
+}
+
+// SmartCrop picks the cover crop window containing the most edge energy.
+// Energy is measured on a downscaled luminance gradient map, so the cost is
+// independent of the source size.
+func SmartCrop(img image.Image, width, height int) image.Rectangle {
+	b := img.Bounds()
+	crop := CoverCrop(b, width, height)
+	if crop.Dx() == b.Dx() && crop.Dy() == b.Dy() {
+		return crop
+	}
+
+	sample := toNRGBA(Resize(img, smartCropSampleSize, smartCropSampleSize, FitContain))
+	sw, sh := sample.Rect.Dx(), sample.Rect.Dy()
+	ratio := float64(b.Dx()) / float64(sw)
+
+	// Column or row energy sums; the window always spans the other axis fully
+	horizontal := crop.Dx() < b.Dx()
+	length := sh
+	if horizontal {
+		length = sw
+	}
+	energy := make([]float64, length)
+
+	lum := func(x, y int) float64 {
+		o := sample.PixOffset(x, y)
+		return 0.299*float64(sample.Pix[o]) + 0.587*float64(sample.Pix[o+1]) + 0.114*float64(sample.Pix[o+2])
+	}
+	for y := 1; y < sh-1; y++ {
+		for x := 1; x < sw-1; x++ {
+			gx := lum(x+1, y) - lum(x-1, y)
+			gy := lum(x, y+1) - lum(x, y-1)
+			e := math.Sqrt(gx*gx + gy*gy)
+			if horizontal {
+				energy[x] += e
+			} else {
+				energy[y] += e
+			}
+		}
+	}
+
+	window := int(math.Round(float64(crop.Dx()) / ratio))
+	if !horizontal {
+		window = int(math.Round(float64(crop.Dy()) / ratio))
+	}
+	window = clampInt(window, 1, length)
+
+	best, bestScore := (length-window)/2, -1.0
+	center := float64(length-window) / 2
+	sum := 0.0
+	for i := 0; i < window; i++ {
+		sum += energy[i]
+	}
+	for start := 0; start+window <= length; start++ {
+		if start > 0 {
+			sum += energy[start+window-1] - energy[start-1]
+		}
+		// Slightly prefer central windows so flat images crop like CoverCrop
+		score := sum * (1 - 0.1*math.Abs(float64(start)-center)/math.Max(center, 1))
+		if score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+
+	offset := int(math.Round(float64(best) * ratio))
+	if horizontal {
+		x := clampInt(b.Min.X+offset, b.Min.X, b.Max.X-crop.Dx())
+		return image.Rect(x, b.Min.Y, x+crop.Dx(), b.Max.Y)
+	}
+	y := clampInt(b.Min.Y+offset, b.Min.Y, b.Max.Y-crop.Dy())
+	return image.Rect(b.Min.X, y, b.Max.X, y+crop.Dy())
+}
+
+func fractionRect(bounds image.Rectangle, r RectF) image.Rectangle {
+	x0 := bounds.Min.X + int(math.Round(clamp01(r.X)*float64(bounds.Dx())))
+	y0 := bounds.Min.Y + int(math.Round(clamp01(r.Y)*float64(bounds.Dy())))
+	x1 := bounds.Min.X + int(math.Round(clamp01(r.X+r.Width)*float64(bounds.Dx())))
+	y1 := bounds.Min.Y + int(math.Round(clamp01(r.Y+r.Height)*float64(bounds.Dy())))
+	rect := image.Rect(x0, y0, x1, y1).Intersect(bounds)
+	if rect.Empty() {
+		return bounds
+	}
+	return rect
+}
+
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			dst.Set(x, y, img.At(r.Min.X+x, r.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func clampInt(v, lo, hi int) int {
+	if hi < lo {
+		return lo
+	}
+	return max(lo, min(hi, v))
+}
@@ -0,0 +1,84 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+const DefaultQuality = 90
+
+// Encode writes img in the given format. Quality only applies to JPEG.
+func Encode(img image.Image, format string, quality int) ([]byte, error) {
+	if quality <= 0 || quality > 100 {
+		quality = DefaultQuality
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		err = png.Encode(&buf, img)
+	case FormatGIF:
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return nil, fmt.Errorf("%w: cannot encode %q", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decodes a single image frame. The header is checked against the
+// configured limits first, so oversized images are refused before any pixel
+// memory is allocated. SVGs are rasterized at their intrinsic size.
+func Decode(data []byte) (image.Image, string, error) {
+	if IsSVG(data) {
+		img, err := RasterizeSVG(data, 0, 0, "")
+		return img, FormatSVG, err
+	}
+	if _, err := CheckLimits(data); err != nil {
+		return nil, "", err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return img, format, nil
+}
+
+// VariantFormat returns the format derived renditions of a source are encoded
+// in. JPEG stays JPEG; everything else becomes PNG, which keeps transparency
+// and needs no encoder beyond the standard library.
+func VariantFormat(source string) string {
+	if source == FormatJPEG {
+		return FormatJPEG
+	}
+	return FormatPNG
+}
+
+// FormatFromExtension maps a file extension to a format
+func FormatFromExtension(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return FormatJPEG
+	case ".png":
+		return FormatPNG
+	case ".gif":
+		return FormatGIF
+	case ".webp":
+		return FormatWebP
+	case ".svg":
+		return FormatSVG
+	}
+	return ""
+}
@@ -0,0 +1,292 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Exif holds the fields extracted from an image's EXIF block
+type Exif struct {
+	Orientation int
+	Fields      map[string]string
+}
+
+var errNoExif = errors.New("no exif data")
+
+var ifd0Tags = map[uint16]string{
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013B: "Artist",
+	0x8298: "Copyright",
+}
+
+var exifIFDTags = map[uint16]string{
+	0x829A: "ExposureTime",
+	0x829D: "FNumber",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x920A: "FocalLength",
+	0xA002: "PixelXDimension",
+	0xA003: "PixelYDimension",
+	0xA430: "CameraOwnerName",
+	0xA431: "BodySerialNumber",
+	0xA433: "LensMake",
+	0xA434: "LensModel",
+	0xA435: "LensSerialNumber",
+}
+
+var gpsIFDTags = map[uint16]string{
+	0x0001: "GPSLatitudeRef",
+	0x0002: "GPSLatitude",
+	0x0003: "GPSLongitudeRef",
+	0x0004: "GPSLongitude",
+	0x0005: "GPSAltitudeRef",
+	0x0006: "GPSAltitude",
+	0x001D: "GPSDateStamp",
+}
+
+const (
+	tagOrientation = 0x0112
+	tagExifIFD     = 0x8769
+	tagGPSIFD      = 0x8825
+)
+
+// ReadExif extracts EXIF fields from a JPEG, PNG or WebP file. Files without
+// EXIF yield an empty result with orientation 1.
+func ReadExif(data []byte, format string) (*Exif, error) {
+	var raw []byte
+	var err error
+	switch format {
+	case FormatJPEG:
+		raw, err = jpegExif(data)
+	case FormatPNG:
+		raw, err = pngExif(data)
+	case FormatWebP:
+		raw, err = webpExif(data)
+	default:
+		err = errNoExif
+	}
+
+	if errors.Is(err, errNoExif) {
+		return &Exif{Orientation: 1, Fields: map[string]string{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseTIFF(raw)
+}
+
+func jpegExif(data []byte) ([]byte, error) {
+	segments, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segments {
+		if seg.marker == 0xE1 && bytes.HasPrefix(seg.payload, []byte("Exif\x00\x00")) {
+			return seg.payload[6:], nil
+		}
+	}
+	return nil, errNoExif
+}
+
+func pngExif(data []byte) ([]byte, error) {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		if c.kind == "eXIf" {
+			return c.data, nil
+		}
+	}
+	return nil, errNoExif
+}
+
+func webpExif(data []byte) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		if c.kind == "EXIF" {
+			return bytes.TrimPrefix(c.data, []byte("Exif\x00\x00")), nil
+		}
+	}
+	return nil, errNoExif
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func parseTIFF(data []byte) (*Exif, error) {
+	if len(data) < 8 {
+		return nil, errors.New("exif: truncated header")
+	}
+
+	t := tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("exif: invalid byte order")
+	}
+
+	result := &Exif{Orientation: 1, Fields: map[string]string{}}
+	ifd0 := t.order.Uint32(data[4:8])
+
+	entries, err := t.readIFD(ifd0)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		switch e.tag {
+		case tagOrientation:
+			if o := e.uint(t); o >= 1 && o <= 8 {
+				result.Orientation = int(o)
+			}
+		case tagExifIFD:
+			t.collect(e.uint(t), exifIFDTags, result.Fields)
+		case tagGPSIFD:
+			t.collect(e.uint(t), gpsIFDTags, result.Fields)
+		default:
+			if name, ok := ifd0Tags[e.tag]; ok {
+				result.Fields[name] = e.format(t)
+			}
+		}
+	}
+	return result, nil
+}
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+var tiffTypeSize = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (t tiffReader) readIFD(offset uint32) ([]ifdEntry, error) {
+	if int(offset)+2 > len(t.data) {
+		return nil, errors.New("exif: ifd out of range")
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	entries := make([]ifdEntry, 0, count)
+
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(t.data) {
+			return nil, errors.New("exif: truncated ifd")
+		}
+		raw := t.data[start : start+12]
+		e := ifdEntry{
+			tag:   t.order.Uint16(raw[0:]),
+			typ:   t.order.Uint16(raw[2:]),
+			count: t.order.Uint32(raw[4:]),
+		}
+
+		size, ok := tiffTypeSize[e.typ]
+		if !ok || e.count > 1<<16 {
+			continue
+		}
+		total := size * e.count
+		if total <= 4 {
+			e.value = raw[8 : 8+total]
+		} else {
+			valueOffset := t.order.Uint32(raw[8:])
+			if uint64(valueOffset)+uint64(total) > uint64(len(t.data)) {
+				continue
+			}
+			e.value = t.data[valueOffset : valueOffset+total]
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (t tiffReader) collect(offset uint32, names map[uint16]string, fields map[string]string) {
+	entries, err := t.readIFD(offset)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if name, ok := names[e.tag]; ok {
+			fields[name] = e.format(t)
+		}
+	}
+}
+
+func (e ifdEntry) uint(t tiffReader) uint32 {
+	switch e.typ {
+	case 3:
+		if len(e.value) >= 2 {
+			return uint32(t.order.Uint16(e.value))
+		}
+	case 4, 9:
+		if len(e.value) >= 4 {
+			return t.order.Uint32(e.value)
+		}
+	case 1, 7:
+		if len(e.value) >= 1 {
+			return uint32(e.value[0])
+		}
+	}
+	return 0
+}
+
+func (e ifdEntry) format(t tiffReader) string {
+	switch e.typ {
+	case 2:
+		return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+	case 3:
+		parts := make([]string, 0, e.count)
+		for i := 0; i+2 <= len(e.value); i += 2 {
+			parts = append(parts, strconv.Itoa(int(t.order.Uint16(e.value[i:]))))
+		}
+		return strings.Join(parts, " ")
+	case 4:
+		parts := make([]string, 0, e.count)
+		for i := 0; i+4 <= len(e.value); i += 4 {
+			parts = append(parts, strconv.FormatUint(uint64(t.order.Uint32(e.value[i:])), 10))
+		}
+		return strings.Join(parts, " ")
+	case 5, 10:
+		parts := make([]string, 0, e.count)
+		for i := 0; i+8 <= len(e.value); i += 8 {
+			num := t.order.Uint32(e.value[i:])
+			den := t.order.Uint32(e.value[i+4:])
+			if e.typ == 10 {
+				parts = append(parts, formatRational(float64(int32(num)), float64(int32(den))))
+			} else {
+				parts = append(parts, formatRational(float64(num), float64(den)))
+			}
+		}
+		return strings.Join(parts, " ")
+	case 1, 7:
+		if e.count <= 4 {
+			parts := make([]string, 0, e.count)
+			for _, b := range e.value {
+				parts = append(parts, strconv.Itoa(int(b)))
+			}
+			return strings.Join(parts, " ")
+		}
+		return strings.TrimRight(string(e.value), "\x00")
+	}
+	return ""
+}
+
+func formatRational(num, den float64) string {
+	if den == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(num/den, 'f', -1, 64)
+}
@@ -0,0 +1,436 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxICCSize bounds the decompressed size of an embedded profile
+const maxICCSize = 4 << 20
+
+// ColorProfile is the part of an ICC profile needed to map RGB pixels to
+// sRGB: the matrix/TRC model used by camera and display profiles.
+type ColorProfile struct {
+	Description string
+	// Supported is false for profiles that are not RGB matrix/TRC profiles
+	// (CMYK, gray, LUT based). Their pixels are left as they are.
+	Supported bool
+
+	colorants [3][3]float64
+	curves    [3]toneCurve
+}
+
+// toneCurve maps an encoded channel value in [0,1] to linear light
+type toneCurve func(float64) float64
+
+// sRGB colorants adapted to the D50 profile connection space, as published
+// in the ICC sRGB profile.
+var srgbColorants = [3][3]float64{
+	{0.4361, 0.2225, 0.0139},
+	{0.3851, 0.7169, 0.0971},
+	{0.1431, 0.0606, 0.7141},
+}
+
+// xyzToSRGB converts D50 XYZ to linear sRGB
+var xyzToSRGB = invert3(columns(srgbColorants))
+
+// ReadICC returns the raw ICC profile embedded in a JPEG, PNG or WebP file,
+// or nil when there is none.
+func ReadICC(data []byte) []byte {
+	switch DetectFormat(data) {
+	case FormatJPEG:
+		return jpegICC(data)
+	case FormatPNG:
+		return pngICC(data)
+	case FormatWebP:
+		chunks, err := webpChunks(data)
+		if err != nil {
+			return nil
+		}
+		for _, c := range chunks {
+			if c.kind == "ICCP" {
+				return c.data
+			}
+		}
+	}
+	return nil
+}
+
+// jpegICC reassembles a profile split across APP2 segments. Each segment
+// carries its sequence number and the total count after the identifier.
+func jpegICC(data []byte) []byte {
+	segments, err := jpegSegments(data)
+	if err != nil {
+		return nil
+	}
+
+	type part struct {
+		seq  byte
+		data []byte
+	}
+	var parts []part
+	for _, seg := range segments {
+		if !isJPEGICC(seg) || len(seg.payload) < 14 {
+			continue
+		}
+		parts = append(parts, part{seq: seg.payload[12], data: seg.payload[14:]})
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].seq < parts[j].seq })
+
+	var buf bytes.Buffer
+	for _, p := range parts {
+		buf.Write(p.data)
+	}
+	return buf.Bytes()
+}
+
+// pngICC inflates the iCCP chunk: a profile name, a NUL, the compression
+// method and the zlib stream.
+func pngICC(data []byte) []byte {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return nil
+	}
+	for _, c := range chunks {
+		if c.kind != "iCCP" {
+			continue
+		}
+		nul := bytes.IndexByte(c.data, 0)
+		if nul < 0 || nul+2 > len(c.data) || c.data[nul+1] != 0 {
+			return nil
+		}
+		r, err := zlib.NewReader(bytes.NewReader(c.data[nul+2:]))
+		if err != nil {
+			return nil
+		}
+		defer r.Close()
+		profile, err := io.ReadAll(io.LimitReader(r, maxICCSize+1))
+		if err != nil || len(profile) > maxICCSize {
+			return nil
+		}
+		return profile
+	}
+	return nil
+}
+
+// ParseICC reads the description, colorants and tone curves of a profile
+func ParseICC(profile []byte) (*ColorProfile, error) {
+	if len(profile) < 132 || string(profile[36:40]) != "acsp" {
+		return nil, errMalformed
+	}
+
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	if count > (len(profile)-132)/12 {
+		return nil, errMalformed
+	}
+	for i := 0; i < count; i++ {
+		entry := profile[132+12*i:]
+		offset := int64(binary.BigEndian.Uint32(entry[4:]))
+		size := int64(binary.BigEndian.Uint32(entry[8:]))
+		if offset+size > int64(len(profile)) {
+			return nil, errMalformed
+		}
+		tags[string(entry[:4])] = profile[offset : offset+size]
+	}
+
+	p := &ColorProfile{Description: iccText(tags["desc"])}
+	if string(profile[16:20]) != "RGB " || string(profile[20:24]) != "XYZ " {
+		return p, nil
+	}
+
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, ok := iccXYZ(tags[sig])
+		if !ok {
+			return p, nil
+		}
+		p.colorants[i] = xyz
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, ok := iccCurve(tags[sig])
+		if !ok {
+			return p, nil
+		}
+		p.curves[i] = curve
+	}
+	p.Supported = true
+	return p, nil
+}
+
+// IsSRGB reports whether the profile describes sRGB, either by name or by
+// having sRGB's colorants and tone curve.
+func (p *ColorProfile) IsSRGB() bool {
+	if strings.Contains(strings.ToLower(p.Description), "srgb") {
+		return true
+	}
+	if !p.Supported {
+		return false
+	}
+	for i := range p.colorants {
+		for j := range p.colorants[i] {
+			if math.Abs(p.colorants[i][j]-srgbColorants[i][j]) > 0.003 {
+				return false
+			}
+		}
+	}
+	for _, curve := range p.curves {
+		for _, v := range []float64{0.05, 0.25, 0.5, 0.75} {
+			if math.Abs(curve(v)-srgbLinear(v)) > 0.005 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ToSRGB converts the pixels of img from the profile's colour space to sRGB.
+// Unsupported and sRGB profiles return img unchanged.
+func (p *ColorProfile) ToSRGB(img image.Image) image.Image {
+	if !p.Supported || p.IsSRGB() {
+		return img
+	}
+
+	var in [3][256]float64
+	for c := range in {
+		for v := range in[c] {
+			in[c][v] = p.curves[c](float64(v) / 255)
+		}
+	}
+	m := mul3(xyzToSRGB, columns(p.colorants))
+
+	var out [4096]uint8
+	for i := range out {
+		out[i] = uint8(math.Round(srgbEncode(float64(i)/4095) * 255))
+	}
+	encode := func(v float64) uint8 {
+		if v <= 0 {
+			return 0
+		}
+		if v >= 1 {
+			return 255
+		}
+		return out[int(v*4095+0.5)]
+	}
+
+	src := toNRGBA(img)
+	dst := image.NewNRGBA(src.Rect)
+	for i := 0; i+3 < len(src.Pix); i += 4 {
+		r, g, b := in[0][src.Pix[i]], in[1][src.Pix[i+1]], in[2][src.Pix[i+2]]
+		dst.Pix[i] = encode(m[0][0]*r + m[0][1]*g + m[0][2]*b)
+		dst.Pix[i+1] = encode(m[1][0]*r + m[1][1]*g + m[1][2]*b)
+		dst.Pix[i+2] = encode(m[2][0]*r + m[2][1]*g + m[2][2]*b)
+		dst.Pix[i+3] = src.Pix[i+3]
+	}
+	return dst
+}
+
+// EmbeddedProfile parses the ICC profile of an encoded image. It returns nil
+// when the file has no profile or the profile cannot be read.
+func EmbeddedProfile(data []byte) *ColorProfile {
+	raw := ReadICC(data)
+	if raw == nil {
+		return nil
+	}
+	p, err := ParseICC(raw)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// NormalizeColor converts img, decoded from data, to sRGB when data carries
+// a non-sRGB profile. Derived renditions are encoded without a profile, so
+// their pixels have to be sRGB to render as intended.
+func NormalizeColor(data []byte, img image.Image) image.Image {
+	if p := EmbeddedProfile(data); p != nil {
+		return p.ToSRGB(img)
+	}
+	return img
+}
+
+func iccXYZ(tag []byte) ([3]float64, bool) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, false
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, true
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// iccCurve reads a curveType ("curv") or parametricCurveType ("para") tag
+func iccCurve(tag []byte) (toneCurve, bool) {
+	if len(tag) < 12 {
+		return nil, false
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case n == 0:
+			return func(v float64) float64 { return v }, true
+		case n == 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(v float64) float64 { return math.Pow(v, gamma) }, len(tag) >= 14
+		case len(tag) < 12+2*n:
+			return nil, false
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+		}
+		return func(v float64) float64 {
+			pos := v * float64(n-1)
+			i := int(pos)
+			if i >= n-1 {
+				return table[n-1]
+			}
+			frac := pos - float64(i)
+			return table[i]*(1-frac) + table[i+1]*frac
+		}, true
+
+	case "para":
+		kind := binary.BigEndian.Uint16(tag[8:])
+		params := []int{1, 3, 4, 5, 7}
+		if int(kind) >= len(params) || len(tag) < 12+4*params[kind] {
+			return nil, false
+		}
+		var a [7]float64
+		a[1] = 1
+		for i := 0; i < params[kind]; i++ {
+			a[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, ca, cb, cc, cd, ce, cf := a[0], a[1], a[2], a[3], a[4], a[5], a[6]
+		pow := func(v float64) float64 {
+			if v <= 0 {
+				return 0
+			}
+			return math.Pow(v, g)
+		}
+		switch kind {
+		case 0:
+			return pow, true
+		case 1:
+			return func(v float64) float64 { return pow(ca*v + cb) }, true
+		case 2:
+			return func(v float64) float64 { return pow(ca*v+cb) + cc }, true
+		case 3:
+			return func(v float64) float64 {
+				if v >= cd {
+					return pow(ca*v + cb)
+				}
+				return cc * v
+			}, true
+		default:
+			return func(v float64) float64 {
+				if v >= cd {
+					return pow(ca*v+cb) + ce
+				}
+				return cc*v + cf
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// iccText reads a v2 textDescriptionType or a v4 multiLocalizedUnicodeType
+// tag, taking the first record of the latter.
+func iccText(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if n > len(tag)-12 {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+	case "mluc":
+		if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:]) == 0 {
+			return ""
+		}
+		length := int(binary.BigEndian.Uint32(tag[20:]))
+		offset := int(binary.BigEndian.Uint32(tag[24:]))
+		if offset+length > len(tag) {
+			return ""
+		}
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(tag[offset+2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	return ""
+}
+
+func srgbLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// columns turns a list of colorants into the matrix mapping RGB to XYZ
+func columns(c [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			m[i][j] = c[j][i]
+		}
+	}
+	return m
+}
+
+func mul3(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func invert3(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	return [3][3]float64{
+		{
+			(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det,
+			(m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det,
+			(m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det,
+		},
+		{
+			(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det,
+			(m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det,
+			(m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det,
+		},
+		{
+			(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det,
+			(m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det,
+			(m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det,
+		},
+	}
+}
@@ -0,0 +1,198 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrImageTooLarge is returned for images whose header announces more pixels,
+// frames or decode memory than the configured limits allow
+var ErrImageTooLarge = errors.New("image exceeds processing limits")
+
+// bytesPerPixel is the in-memory cost of a decoded pixel (8-bit RGBA)
+const bytesPerPixel = 4
+
+// Limits bounds what Decode accepts. Zero fields are unlimited.
+type Limits struct {
+	MaxPixels   int64         // Width x height of a single frame
+	MaxFrames   int           // Frames of an animated image
+	MaxMemory   int64         // Estimated bytes needed to hold every decoded frame
+	MaxDuration time.Duration // Total play time of an animation
+}
+
+var (
+	limitsMu sync.RWMutex
+	limits   Limits
+)
+
+// SetLimits configures the limits enforced by Decode and CheckLimits
+func SetLimits(l Limits) {
+	limitsMu.Lock()
+	limits = l
+	limitsMu.Unlock()
+}
+
+func currentLimits() Limits {
+	limitsMu.RLock()
+	defer limitsMu.RUnlock()
+	return limits
+}
+
+// Header is what an image file declares about itself, read without
+// decoding any pixel data
+type Header struct {
+	Format   string
+	Width    int
+	Height   int
+	Frames   int
+	Duration time.Duration // Total play time of one loop, zero for still images
+}
+
+// ReadHeader parses the dimensions and frame count of an image from its
+// container headers only
+func ReadHeader(data []byte) (*Header, error) {
+	if IsSVG(data) {
+		w, h, err := svgSize(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Header{Format: FormatSVG, Width: int(math.Round(w)), Height: int(math.Round(h)), Frames: 1}, nil
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	h := &Header{Format: format, Width: cfg.Width, Height: cfg.Height, Frames: 1}
+	switch format {
+	case FormatGIF:
+		if h.Frames, h.Duration, err = gifFrames(data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+	case FormatWebP:
+		h.Frames, h.Duration = webpFrames(data)
+	}
+	return h, nil
+}
+
+// CheckLimits rejects images whose headers exceed the configured limits,
+// before anything is decoded. SVGs always pass: they are vectors, and their
+// rasters are sized to fit the limits.
+func CheckLimits(data []byte) (*Header, error) {
+	h, err := ReadHeader(data)
+	if err != nil || h.Format == FormatSVG {
+		return h, err
+	}
+
+	l := currentLimits()
+	pixels := int64(h.Width) * int64(h.Height)
+	if l.MaxPixels > 0 && pixels > l.MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is more than %d pixels", ErrImageTooLarge, h.Width, h.Height, l.MaxPixels)
+	}
+	if l.MaxFrames > 0 && h.Frames > l.MaxFrames {
+		return nil, fmt.Errorf("%w: %d frames, at most %d allowed", ErrImageTooLarge, h.Frames, l.MaxFrames)
+	}
+	if l.MaxDuration > 0 && h.Duration > l.MaxDuration {
+		return nil, fmt.Errorf("%w: animation plays for %s, at most %s allowed", ErrImageTooLarge, h.Duration, l.MaxDuration)
+	}
+	if memory := pixels * bytesPerPixel * int64(h.Frames); l.MaxMemory > 0 && memory > l.MaxMemory {
+		return nil, fmt.Errorf("%w: decoding needs about %d MiB, at most %d MiB allowed", ErrImageTooLarge, memory>>20, l.MaxMemory>>20)
+	}
+	return h, nil
+}
+
+// gifFrames walks the GIF block structure, counting image descriptors and
+// summing the delays of their graphic control extensions, without
+// decompressing any frame
+func gifFrames(data []byte) (int, time.Duration, error) {
+	if len(data) < 13 {
+		return 0, 0, errMalformed
+	}
+	pos := 13
+	if packed := data[10]; packed&0x80 != 0 {
+		pos += 3 << ((packed & 0x07) + 1)
+	}
+
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	frames, delay := 0, 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension: label, then data sub-blocks
+			// Graphic control extension: delay in hundredths of a second
+			if pos+6 <= len(data) && data[pos+1] == 0xF9 && data[pos+2] == 4 {
+				delay += int(binary.LittleEndian.Uint16(data[pos+4:]))
+			}
+			pos += 2
+			if !skipSubBlocks() {
+				return 0, 0, errMalformed
+			}
+		case 0x2C: // Image descriptor, optional local colour table, LZW data
+			if pos+10 > len(data) {
+				return 0, 0, errMalformed
+			}
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				pos += 3 << ((packed & 0x07) + 1)
+			}
+			pos++ // LZW minimum code size
+			if !skipSubBlocks() {
+				return 0, 0, errMalformed
+			}
+			frames++
+		case 0x3B: // Trailer
+			return gifResult(frames, delay)
+		default:
+			return 0, 0, errMalformed
+		}
+	}
+	// Truncated files still decode as far as they go
+	return gifResult(frames, delay)
+}
+
+func gifResult(frames, delay int) (int, time.Duration, error) {
+	if frames <= 1 {
+		return 1, 0, nil
+	}
+	return frames, time.Duration(delay) * 10 * time.Millisecond, nil
+}
+
+// webpFrames counts the ANMF chunks of an animated WebP and sums their
+// durations
+func webpFrames(data []byte) (int, time.Duration) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return 1, 0
+	}
+	frames, duration := 0, 0
+	for _, c := range chunks {
+		if c.kind == "ANMF" {
+			frames++
+			if len(c.data) >= 15 {
+				// 24-bit little-endian duration in milliseconds
+				duration += int(c.data[12]) | int(c.data[13])<<8 | int(c.data[14])<<16
+			}
+		}
+	}
+	if frames <= 1 {
+		return 1, 0
+	}
+	return frames, time.Duration(duration) * time.Millisecond
+}
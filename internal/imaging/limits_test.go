@@ -0,0 +1,243 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// pngHeader returns a PNG signature followed by an IHDR chunk announcing a
+// width x height RGBA image, with no pixel data
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 6 // 8-bit RGBA
+	return append([]byte("\x89PNG\r\n\x1a\n"), encodePNGChunk("IHDR", ihdr)...)
+}
+
+func encodePNGChunk(kind string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// gifHeader returns the header, logical screen descriptor and a two colour
+// global table of a 1x1 GIF
+func gifHeader() []byte {
+	return []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff")
+}
+
+// gifFrame returns a graphic control extension with delay, in hundredths
+// of a second, and a 1x1 frame
+func gifFrame(delay uint16) []byte {
+	frame := []byte{0x21, 0xF9, 0x04, 0x00}
+	frame = binary.LittleEndian.AppendUint16(frame, delay)
+	frame = append(frame, 0x00, 0x00)
+	return append(frame, 0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00)
+}
+
+func gifFile(parts ...[]byte) []byte {
+	return append(bytes.Join(append([][]byte{gifHeader()}, parts...), nil), 0x3B)
+}
+
+// webpFile wraps chunks in a RIFF WEBP container
+func webpFile(chunks ...[]byte) []byte {
+	body := append([]byte("WEBP"), bytes.Join(chunks, nil)...)
+	data := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body)))
+	return append(data, body...)
+}
+
+func encodeWebPChunk(kind string, data []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32([]byte(kind), uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// vp8x returns an extended WebP header announcing a width x height canvas
+func vp8x(flags byte, width, height int) []byte {
+	data := make([]byte, 10)
+	data[0] = flags
+	data[4], data[5], data[6] = byte(width-1), byte((width-1)>>8), byte((width-1)>>16)
+	data[7], data[8], data[9] = byte(height-1), byte((height-1)>>8), byte((height-1)>>16)
+	return encodeWebPChunk("VP8X", data)
+}
+
+// anmf returns an animation frame chunk lasting duration milliseconds
+func anmf(duration int) []byte {
+	data := make([]byte, 16)
+	data[12], data[13], data[14] = byte(duration), byte(duration>>8), byte(duration>>16)
+	return encodeWebPChunk("ANMF", data)
+}
+
+func setTestLimits(t *testing.T, l Limits) {
+	t.Helper()
+	previous := currentLimits()
+	SetLimits(l)
+	t.Cleanup(func() { SetLimits(previous) })
+}
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Header
+		wantErr error
+	}{
+		{name: "empty", data: nil, wantErr: ErrInvalidImage},
+		{name: "png", data: pngHeader(640, 480), want: Header{Format: FormatPNG, Width: 640, Height: 480, Frames: 1}},
+		{name: "png 60000x60000", data: pngHeader(60000, 60000), want: Header{Format: FormatPNG, Width: 60000, Height: 60000, Frames: 1}},
+		{name: "png truncated signature", data: []byte("\x89PNG\r\n"), wantErr: ErrInvalidImage},
+		{name: "png truncated header", data: pngHeader(640, 480)[:20], wantErr: ErrInvalidImage},
+		{name: "png bad checksum", data: append(pngHeader(640, 480)[:29], 0, 0, 0, 0), wantErr: ErrInvalidImage},
+		{name: "png zero width", data: pngHeader(0, 480), wantErr: ErrInvalidImage},
+		{name: "gif still", data: gifFile(gifFrame(0)), want: Header{Format: FormatGIF, Width: 1, Height: 1, Frames: 1}},
+		{name: "gif animated", data: gifFile(gifFrame(10), gifFrame(20), gifFrame(30)), want: Header{Format: FormatGIF, Width: 1, Height: 1, Frames: 3, Duration: 600 * time.Millisecond}},
+		{name: "gif truncated screen descriptor", data: gifHeader()[:9], wantErr: ErrInvalidImage},
+		{name: "gif truncated colour table", data: gifHeader()[:15], wantErr: ErrInvalidImage},
+		{name: "gif truncated frame", data: append(gifHeader(), gifFrame(10)[:12]...), wantErr: ErrInvalidImage},
+		{name: "gif truncated extension", data: append(gifHeader(), 0x21, 0xF9, 0x04), wantErr: ErrInvalidImage},
+		{name: "gif unknown block", data: gifFile([]byte{0x42}), wantErr: ErrInvalidImage},
+		{name: "gif without trailer", data: append(gifHeader(), bytes.Repeat(gifFrame(5), 2)...), want: Header{Format: FormatGIF, Width: 1, Height: 1, Frames: 2, Duration: 100 * time.Millisecond}},
+		{name: "webp animated", data: webpFile(vp8x(0x02, 300, 200), encodeWebPChunk("ANIM", make([]byte, 6)), anmf(100), anmf(250)), want: Header{Format: FormatWebP, Width: 300, Height: 200, Frames: 2, Duration: 350 * time.Millisecond}},
+		{name: "webp truncated riff", data: []byte("RIFF\x04\x00\x00\x00WE"), wantErr: ErrInvalidImage},
+		{name: "webp without chunks", data: webpFile(), wantErr: ErrInvalidImage},
+		{name: "webp truncated vp8x", data: webpFile(vp8x(0x02, 300, 200)[:12]), wantErr: ErrInvalidImage},
+		{name: "webp chunk overruns the file", data: webpFile(vp8x(0x02, 300, 200), anmf(100), anmf(100)[:10]), want: Header{Format: FormatWebP, Width: 300, Height: 200, Frames: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadHeader(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadHeader error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadHeader: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("ReadHeader = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	setTestLimits(t, Limits{
+		MaxPixels:   50_000_000,
+		MaxFrames:   3,
+		MaxMemory:   256 << 20,
+		MaxDuration: time.Second,
+	})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "within limits", data: pngHeader(4000, 3000)},
+		{name: "png 60000x60000", data: pngHeader(60000, 60000), wantErr: ErrImageTooLarge},
+		{name: "too many frames", data: gifFile(gifFrame(1), gifFrame(1), gifFrame(1), gifFrame(1)), wantErr: ErrImageTooLarge},
+		{name: "plays too long", data: gifFile(gifFrame(80), gifFrame(80)), wantErr: ErrImageTooLarge},
+		{name: "frames need too much memory", data: webpFile(vp8x(0x02, 8000, 6000), anmf(10), anmf(10), anmf(10)), wantErr: ErrImageTooLarge},
+		{name: "malformed", data: gifHeader()[:15], wantErr: ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CheckLimits(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckLimits error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Decode refuses before allocating the pixels
+	if _, _, err := Decode(pngHeader(60000, 60000)); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("Decode error = %v, want %v", err, ErrImageTooLarge)
+	}
+}
+
+func TestGIFFrames(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         []byte
+		wantFrames   int
+		wantDuration time.Duration
+		wantErr      bool
+	}{
+		{name: "shorter than a header", data: []byte("GIF89a"), wantErr: true},
+		{name: "header only", data: gifHeader(), wantFrames: 1},
+		{name: "one frame", data: gifFile(gifFrame(50)), wantFrames: 1},
+		{name: "two frames", data: gifFile(gifFrame(50), gifFrame(25)), wantFrames: 2, wantDuration: 750 * time.Millisecond},
+		{name: "colour table past the end", data: []byte("GIF89a\x01\x00\x01\x00\x87\x00\x00"), wantFrames: 1},
+		{name: "local colour table past the end", data: append(gifHeader(), 0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0x87), wantErr: true},
+		{name: "sub-block past the end", data: append(gifHeader(), 0x21, 0xFE, 0x40, 'x'), wantErr: true},
+		{name: "image descriptor cut short", data: append(gifHeader(), 0x2C, 0, 0), wantErr: true},
+		{name: "garbage block", data: append(gifHeader(), 0x00), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, duration, err := gifFrames(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("gifFrames succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("gifFrames: %v", err)
+			}
+			if frames != tt.wantFrames || duration != tt.wantDuration {
+				t.Errorf("gifFrames = %d, %s, want %d, %s", frames, duration, tt.wantFrames, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestWebPFrames(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         []byte
+		wantFrames   int
+		wantDuration time.Duration
+	}{
+		{name: "not a webp", data: []byte("GIF89a"), wantFrames: 1},
+		{name: "still", data: webpFile(vp8x(0, 10, 10), encodeWebPChunk("VP8L", make([]byte, 5))), wantFrames: 1},
+		{name: "animated", data: webpFile(vp8x(0x02, 10, 10), anmf(40), anmf(40), anmf(0x010000)), wantFrames: 3, wantDuration: 65616 * time.Millisecond},
+		{name: "short frame chunk", data: webpFile(vp8x(0x02, 10, 10), encodeWebPChunk("ANMF", make([]byte, 4)), anmf(40)), wantFrames: 2, wantDuration: 40 * time.Millisecond},
+		{name: "chunk size past the end", data: webpFile(vp8x(0x02, 10, 10), anmf(40), []byte("ANMF\xff\xff\xff\xff")), wantFrames: 1},
+		{name: "truncated chunk header", data: webpFile(vp8x(0x02, 10, 10), anmf(40), anmf(40), []byte("AN")), wantFrames: 2, wantDuration: 80 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, duration := webpFrames(tt.data)
+			if frames != tt.wantFrames || duration != tt.wantDuration {
+				t.Errorf("webpFrames = %d, %s, want %d, %s", frames, duration, tt.wantFrames, tt.wantDuration)
+			}
+		})
+	}
+}
+
+// Every prefix of a valid file either parses or is reported as invalid
+func TestReadHeaderTruncated(t *testing.T) {
+	files := map[string][]byte{
+		"png":  pngHeader(60000, 60000),
+		"gif":  gifFile(gifFrame(10), gifFrame(10)),
+		"webp": webpFile(vp8x(0x02, 300, 200), encodeWebPChunk("ANIM", make([]byte, 6)), anmf(100), anmf(100)),
+	}
+	for name, data := range files {
+		for n := range len(data) {
+			if _, err := ReadHeader(data[:n]); err != nil && !errors.Is(err, ErrInvalidImage) {
+				t.Errorf("ReadHeader(%s[:%d]) error = %v, want %v", name, n, err, ErrInvalidImage)
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+// PerceptualHash computes the 64-bit difference hash (dHash) of img: the image
+// is reduced to a 9x8 grayscale grid and each bit records whether a cell is
+// brighter than its right neighbour. Resized or recompressed copies of a
+// photo hash to values a few bits apart.
+func PerceptualHash(img image.Image) (string, error) {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return "", ErrInvalidImage
+	}
+
+	grid := toNRGBA(Resize(img, 9, 8, FitFill))
+	lum := func(x, y int) float64 {
+		o := grid.PixOffset(grid.Rect.Min.X+x, grid.Rect.Min.Y+y)
+		return 0.299*float64(grid.Pix[o]) + 0.587*float64(grid.Pix[o+1]) + 0.114*float64(grid.Pix[o+2])
+	}
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if lum(x, y) > lum(x+1, y) {
+				hash |= 1
+			}
+		}
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], hash)
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// HammingDistance returns the number of differing bits between two hashes
+// produced by PerceptualHash, or -1 if either is malformed
+func HammingDistance(a, b string) int {
+	x, errA := strconv.ParseUint(a, 16, 64)
+	y, errB := strconv.ParseUint(b, 16, 64)
+	if errA != nil || errB != nil || len(a) != 16 || len(b) != 16 {
+		return -1
+	}
+	return bits.OnesCount64(x ^ y)
+}
@@ -0,0 +1,137 @@
+package imaging
+
+import (
+	"encoding/base64"
+	"image"
+	"math"
+	"strings"
+)
+
+const (
+	blurHashSampleSize = 32
+	lqipWidth          = 16
+	lqipQuality        = 40
+)
+
+// Placeholders holds the cheap previews clients render while an image loads
+type Placeholders struct {
+	BlurHash string
+	LQIP     string // data URI of a tiny JPEG
+}
+
+// GeneratePlaceholders computes the BlurHash and low-quality placeholder of img
+func GeneratePlaceholders(img image.Image) (Placeholders, error) {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return Placeholders{}, ErrInvalidImage
+	}
+
+	sample := Resize(img, blurHashSampleSize, blurHashSampleSize, FitContain)
+	xComponents, yComponents := 4, 3
+	if b.Dy() > b.Dx() {
+		xComponents, yComponents = 3, 4
+	}
+
+	tiny, err := Encode(Resize(sample, lqipWidth, 0, FitContain), FormatJPEG, lqipQuality)
+	if err != nil {
+		return Placeholders{}, err
+	}
+
+	return Placeholders{
+		BlurHash: BlurHash(sample, xComponents, yComponents),
+		LQIP:     "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(tiny),
+	}, nil
+}
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes img as a BlurHash string (https://blurha.sh) using the
+// given number of horizontal and vertical components (1-9 each).
+func BlurHash(img image.Image, xComponents, yComponents int) string {
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			factors = append(factors, blurHashFactor(src, w, h, i, j))
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maxValue := 1.0
+	if len(factors) > 1 {
+		actualMax := 0.0
+		for _, f := range factors[1:] {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, f := range factors[1:] {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+	return hash.String()
+}
+
+func blurHashFactor(img *image.NRGBA, w, h, i, j int) [3]float64 {
+	var r, g, b float64
+	for y := 0; y < h; y++ {
+		cy := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+		for x := 0; x < w; x++ {
+			basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) * cy
+			o := img.PixOffset(x, y)
+			r += basis * sRGBToLinear(img.Pix[o])
+			g += basis * sRGBToLinear(img.Pix[o+1])
+			b += basis * sRGBToLinear(img.Pix[o+2])
+		}
+	}
+
+	normalisation := 2.0
+	if i == 0 && j == 0 {
+		normalisation = 1
+	}
+	scale := normalisation / float64(w*h)
+	return [3]float64{r * scale, g * scale, b * scale}
+}
+
+func encode83(value, length int) string {
+	out := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		out[i-1] = base83Chars[digit]
+	}
+	return string(out)
+}
+
+func sRGBToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
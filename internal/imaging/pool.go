@@ -0,0 +1,73 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrProcessingTimeout is returned when an image operation does not finish
+// within its time budget
+var ErrProcessingTimeout = errors.New("image processing timed out")
+
+// Pool bounds the number of decode/encode operations running at once, so a
+// burst of large images cannot exhaust memory or CPU.
+type Pool struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// NewPool returns a pool running at most workers operations at a time, each
+// allowed timeout from the moment it is submitted. A zero timeout waits forever.
+func NewPool(workers int, timeout time.Duration) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{slots: make(chan struct{}, workers), timeout: timeout}
+}
+
+// Run runs fn in a slot of the pool and returns its results. Waiting for a
+// slot counts against the time budget. Once the budget is spent Run returns
+// ErrProcessingTimeout and the results fn produces later are dropped; fn keeps
+// its slot until it actually returns, so the concurrency bound holds even for
+// abandoned work. fn must hand everything it computes back as its result
+// rather than assigning to variables of the caller, which it may outlive.
+// Panics raised by decoders on hostile input are turned into ErrInvalidImage.
+func Run[T any](p *Pool, fn func() (T, error)) (T, error) {
+	var zero T
+	var deadline <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-deadline:
+		return zero, fmt.Errorf("%w: no worker available within %s", ErrProcessingTimeout, p.timeout)
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() { <-p.slots }()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("%w: %v", ErrInvalidImage, r)}
+			}
+		}()
+		value, err := fn()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-deadline:
+		return zero, fmt.Errorf("%w: exceeded %s", ErrProcessingTimeout, p.timeout)
+	}
+}
@@ -0,0 +1,42 @@
+package imaging
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	pool := NewPool(1, 50*time.Millisecond)
+
+	value, err := Run(pool, func() (int, error) { return 42, nil })
+	if err != nil || value != 42 {
+		t.Errorf("Run = %d, %v, want 42", value, err)
+	}
+
+	value, err = Run(pool, func() (int, error) { panic("hostile input") })
+	if !errors.Is(err, ErrInvalidImage) || value != 0 {
+		t.Errorf("panicking Run = %d, %v, want %v", value, err, ErrInvalidImage)
+	}
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	value, err = Run(pool, func() (int, error) {
+		defer close(finished)
+		<-release
+		return 7, nil
+	})
+	if !errors.Is(err, ErrProcessingTimeout) || value != 0 {
+		t.Errorf("slow Run = %d, %v, want %v", value, err, ErrProcessingTimeout)
+	}
+
+	// The abandoned work keeps its slot until it returns
+	if _, err := Run(pool, func() (int, error) { return 1, nil }); !errors.Is(err, ErrProcessingTimeout) {
+		t.Errorf("Run while the slot is held = %v, want %v", err, ErrProcessingTimeout)
+	}
+	close(release)
+	<-finished
+	if value, err := Run(pool, func() (int, error) { return 1, nil }); err != nil || value != 1 {
+		t.Errorf("Run after the slot was freed = %d, %v, want 1", value, err)
+	}
+}
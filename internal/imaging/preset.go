@@ -0,0 +1,89 @@
+package imaging
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ScopeAll     = "all"
+	ScopeAsset   = "asset"
+	ScopeProfile = "profile"
+)
+
+// Built-in rendition names, which configured presets may not use
+const (
+	PresetOriginal = "original" // Full-size rendition, e.g. watermarked
+	PresetPoster   = "poster"   // Static first frame of an animation
+)
+
+// Preset is a named, fixed rendition generated for every matching upload
+type Preset struct {
+	Name   string
+	Width  int
+	Height int
+	Fit    string
+	Scope  string
+}
+
+// Matches reports whether the preset applies to uploads of the given scope
+func (p Preset) Matches(scope string) bool {
+	return p.Scope == ScopeAll || p.Scope == scope
+}
+
+// ParsePresets parses a comma separated list of presets in the form
+// name:WIDTHxHEIGHT[:fit[:scope]], e.g. "avatar_64:64x64:cover:profile".
+// A zero width or height keeps the aspect ratio.
+func ParsePresets(spec string) ([]Preset, error) {
+	var presets []Preset
+	seen := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 4 {
+			return nil, fmt.Errorf("invalid preset %q", item)
+		}
+
+		p := Preset{Name: parts[0], Fit: FitContain, Scope: ScopeAll}
+		if p.Name == "" || seen[p.Name] || p.Name == PresetOriginal || p.Name == PresetPoster {
+			return nil, fmt.Errorf("invalid or duplicate preset name %q", p.Name)
+		}
+
+		size := strings.SplitN(parts[1], "x", 2)
+		if len(size) != 2 {
+			return nil, fmt.Errorf("invalid preset size %q", parts[1])
+		}
+		var err error
+		if p.Width, err = strconv.Atoi(size[0]); err != nil || p.Width < 0 {
+			return nil, fmt.Errorf("invalid preset width %q", size[0])
+		}
+		if p.Height, err = strconv.Atoi(size[1]); err != nil || p.Height < 0 {
+			return nil, fmt.Errorf("invalid preset height %q", size[1])
+		}
+		if p.Width == 0 && p.Height == 0 {
+			return nil, fmt.Errorf("preset %q needs a width or a height", p.Name)
+		}
+
+		if len(parts) > 2 {
+			p.Fit = parts[2]
+			if !ValidFit(p.Fit) {
+				return nil, fmt.Errorf("invalid preset fit %q", p.Fit)
+			}
+		}
+		if len(parts) > 3 {
+			p.Scope = parts[3]
+			if p.Scope != ScopeAll && p.Scope != ScopeAsset && p.Scope != ScopeProfile {
+				return nil, fmt.Errorf("invalid preset scope %q", p.Scope)
+			}
+		}
+
+		seen[p.Name] = true
+		presets = append(presets, p)
+	}
+	return presets, nil
+}
@@ -0,0 +1,69 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// ProfileOptions configures how profile photos are normalized
+type ProfileOptions struct {
+	MaxSize int    // Side of the square output; smaller photos are not upscaled
+	Format  string // FormatJPEG or FormatPNG
+	Quality int    // JPEG quality
+}
+
+// ValidProfileFormat reports whether profile photos can be stored in format
+func ValidProfileFormat(format string) bool {
+	return format == FormatJPEG || format == FormatPNG
+}
+
+// NormalizeProfile turns an uploaded photo into a square profile picture:
+// decoded within the configured limits, rotated upright, converted to sRGB,
+// cropped to a square around hint's focal point (or the smart crop) and
+// capped at MaxSize. The result carries no metadata. Animated images keep
+// their first frame and SVGs are rasterized.
+func NormalizeProfile(data []byte, opts ProfileOptions, hint CropHint) ([]byte, error) {
+	format := DetectFormat(data)
+	if format == "" {
+		return nil, fmt.Errorf("%w: not a supported image", ErrInvalidImage)
+	}
+
+	var img image.Image
+	var err error
+	if format == FormatSVG {
+		img, err = DecodeAt(data, opts.MaxSize, opts.MaxSize, FitCover)
+	} else {
+		img, _, err = Decode(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if exif, err := ReadExif(data, format); err == nil {
+		img = ApplyOrientation(img, exif.Orientation)
+	}
+	img = NormalizeColor(data, img)
+
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	if opts.MaxSize > 0 && side > opts.MaxSize {
+		side = opts.MaxSize
+	}
+	img = ResizeWithHint(img, side, side, FitCover, hint)
+
+	if opts.Format == FormatJPEG {
+		img = flatten(img, color.White)
+	}
+	return Encode(img, opts.Format, opts.Quality)
+}
+
+// flatten composites img over a solid background, for formats without alpha
+func flatten(img image.Image, background color.Color) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,75 @@
+package imaging
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	FitCover   = "cover"   // Fill the box, cropping the overflow
+	FitContain = "contain" // Fit inside the box, never upscaling
+	FitFill    = "fill"    // Stretch to the exact box
+)
+
+// ValidFit reports whether fit is a known resize mode
+func ValidFit(fit string) bool {
+	return fit == FitCover || fit == FitContain || fit == FitFill
+}
+
+// Resize scales img into a width x height box according to fit. When one
+// dimension is zero it is derived from the source aspect ratio.
+func Resize(img image.Image, width, height int, fit string) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 || (width <= 0 && height <= 0) {
+		return img
+	}
+
+	if width <= 0 || height <= 0 {
+		// Only one side constrained: behave like contain on that side
+		fit = FitContain
+		if width <= 0 {
+			width = int(math.Round(float64(w) * float64(height) / float64(h)))
+		} else {
+			height = int(math.Round(float64(h) * float64(width) / float64(w)))
+		}
+	}
+
+	switch fit {
+	case FitFill:
+		return scale(img, b, width, height)
+	case FitCover:
+		return scale(img, CoverCrop(b, width, height), width, height)
+	default:
+		ratio := math.Min(float64(width)/float64(w), float64(height)/float64(h))
+		if ratio >= 1 {
+			return img
+		}
+		dw := max(1, int(math.Round(float64(w)*ratio)))
+		dh := max(1, int(math.Round(float64(h)*ratio)))
+		return scale(img, b, dw, dh)
+	}
+}
+
+// CoverCrop returns the centered region of bounds that has the aspect ratio
+// of width x height.
+func CoverCrop(bounds image.Rectangle, width, height int) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	cw, ch := w, h
+	if float64(w)*float64(height) > float64(h)*float64(width) {
+		cw = max(1, int(math.Round(float64(h)*float64(width)/float64(height))))
+	} else {
+		ch = max(1, int(math.Round(float64(w)*float64(height)/float64(width))))
+	}
+	x := bounds.Min.X + (w-cw)/2
+	y := bounds.Min.Y + (h-ch)/2
+	return image.Rect(x, y, x+cw, y+ch)
+}
+
+func scale(img image.Image, src image.Rectangle, width, height int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,110 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrInvalidImage      = errors.New("invalid image")
+)
+
+// SanitizeResult is the outcome of Sanitize
+type SanitizeResult struct {
+	Data    []byte
+	Exif    *Exif
+	Rotated bool
+}
+
+// Sanitize extracts the EXIF block of an uploaded image and, unless preserve is
+// set, removes all descriptive metadata. JPEG and PNG files carrying a
+// non-default orientation are re-encoded upright; everything else is stripped
+// losslessly. Colour profiles are always kept. SVGs are always rebuilt by
+// SanitizeSVG, whatever preserve says.
+func Sanitize(data []byte, format string, preserve bool) (*SanitizeResult, error) {
+	if format == FormatSVG {
+		clean, err := SanitizeSVG(data)
+		if err != nil {
+			return nil, err
+		}
+		return &SanitizeResult{Data: clean, Exif: &Exif{Orientation: 1, Fields: map[string]string{}}}, nil
+	}
+
+	exif, err := ReadExif(data, format)
+	if err != nil {
+		// Unreadable EXIF is dropped along with the rest of the metadata
+		exif = &Exif{Orientation: 1, Fields: map[string]string{}}
+	}
+
+	result := &SanitizeResult{Data: data, Exif: exif}
+	if preserve {
+		return result, nil
+	}
+
+	if exif.Orientation > 1 && (format == FormatJPEG || format == FormatPNG) {
+		img, _, err := Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := Encode(ApplyOrientation(img, exif.Orientation), format, DefaultQuality)
+		if err != nil {
+			return nil, err
+		}
+		if format == FormatJPEG {
+			encoded = copyJPEGICC(data, encoded)
+		} else {
+			encoded = copyPNGICC(data, encoded)
+		}
+		result.Data = encoded
+		result.Rotated = true
+		return result, nil
+	}
+
+	switch format {
+	case FormatJPEG:
+		result.Data, err = StripJPEGMetadata(data)
+	case FormatPNG:
+		result.Data, err = StripPNGMetadata(data)
+	case FormatWebP:
+		result.Data, err = StripWebPMetadata(data)
+	}
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	return result, nil
+}
+
+// copyPNGICC inserts the iCCP chunk of src after the IHDR chunk of dst
+func copyPNGICC(src, dst []byte) []byte {
+	srcChunks, err := pngChunks(src)
+	if err != nil {
+		return dst
+	}
+	dstChunks, err := pngChunks(dst)
+	if err != nil {
+		return dst
+	}
+
+	var icc *pngChunk
+	for i := range srcChunks {
+		if srcChunks[i].kind == "iCCP" {
+			icc = &srcChunks[i]
+			break
+		}
+	}
+	if icc == nil {
+		return dst
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(dst) + len(icc.raw))
+	buf.Write(pngSignature)
+	for _, c := range dstChunks {
+		buf.Write(c.raw)
+		if c.kind == "IHDR" {
+			buf.Write(icc.raw)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,348 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+
+	// Browsers render SVGs without any size information at 300x150
+	svgDefaultWidth  = 300
+	svgDefaultHeight = 150
+)
+
+// svgElements are the SVG elements kept by SanitizeSVG. Everything else,
+// notably script, foreignObject, image, animation elements and anything from
+// another namespace, is dropped together with its children.
+var svgElements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "symbol": true, "use": true,
+	"title": true, "desc": true, "style": true,
+	"path": true, "rect": true, "circle": true, "ellipse": true,
+	"line": true, "polyline": true, "polygon": true,
+	"text": true, "tspan": true, "textPath": true,
+	"linearGradient": true, "radialGradient": true, "stop": true,
+	"clipPath": true, "mask": true, "pattern": true, "marker": true,
+	"filter": true, "feBlend": true, "feColorMatrix": true, "feComposite": true,
+	"feDropShadow": true, "feFlood": true, "feGaussianBlur": true,
+	"feMerge": true, "feMergeNode": true, "feMorphology": true, "feOffset": true,
+}
+
+var (
+	cssURLPattern    = regexp.MustCompile(`(?i)url\s*\(\s*['"]?\s*([^'")\s]*)`)
+	svgLengthPattern = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+)\s*(px)?\s*$`)
+	svgAttrEscaper   = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	svgTextEscaper   = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+var errNotSVG = errors.New("not an svg document")
+
+// IsSVG reports whether data is an XML document with an svg root element
+func IsSVG(data []byte) bool {
+	start, err := svgRoot(data)
+	return err == nil && start.Name.Local == "svg"
+}
+
+func svgRoot(data []byte) (*xml.StartElement, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != "" || t.Name.Local != "svg" {
+				return nil, errNotSVG
+			}
+			return &t, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errNotSVG
+			}
+		}
+	}
+}
+
+// SanitizeSVG rebuilds an SVG document keeping only drawing elements and
+// presentation attributes. Scripts, event handlers, foreign objects, external
+// references (href, url() or CSS imports pointing outside the document),
+// comments, processing instructions and DTDs are removed.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	var stack []string // Open elements, as written
+	skip := 0          // Depth inside a dropped element
+	rooted := false
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 {
+				skip++
+				continue
+			}
+			if !rooted {
+				if t.Name.Space != "" || t.Name.Local != "svg" {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidImage, errNotSVG)
+				}
+				rooted = true
+			} else if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: content after the root element", ErrInvalidImage)
+			}
+			if t.Name.Space != "" || !svgElements[t.Name.Local] {
+				skip = 1
+				continue
+			}
+			if t.Name.Local == "style" {
+				css, err := svgStyleText(d)
+				if err != nil {
+					return nil, err
+				}
+				if safeCSS(css) {
+					out.WriteString("<style>")
+					svgTextEscaper.WriteString(&out, css)
+					out.WriteString("</style>")
+				}
+				continue
+			}
+
+			out.WriteByte('<')
+			out.WriteString(t.Name.Local)
+			if len(stack) == 0 {
+				out.WriteString(` xmlns="` + svgNamespace + `" xmlns:xlink="` + xlinkNamespace + `"`)
+			}
+			for _, attr := range t.Attr {
+				if name, ok := safeSVGAttr(attr); ok {
+					out.WriteString(" " + name + `="`)
+					svgAttrEscaper.WriteString(&out, attr.Value)
+					out.WriteByte('"')
+				}
+			}
+			out.WriteByte('>')
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(stack) == 0 || t.Name.Space != "" || stack[len(stack)-1] != t.Name.Local {
+				return nil, fmt.Errorf("%w: mismatched end element %s", ErrInvalidImage, t.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+			out.WriteString("</" + t.Name.Local + ">")
+		case xml.CharData:
+			if skip == 0 && len(stack) > 0 {
+				svgTextEscaper.WriteString(&out, string(t))
+			}
+		}
+		// Comments, processing instructions and directives are dropped
+	}
+
+	if !rooted || len(stack) != 0 || skip != 0 {
+		return nil, fmt.Errorf("%w: truncated svg document", ErrInvalidImage)
+	}
+	return out.Bytes(), nil
+}
+
+// svgStyleText reads the text content of a style element up to its end tag
+func svgStyleText(d *xml.Decoder) (string, error) {
+	var css strings.Builder
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			css.Write(t)
+		case xml.EndElement:
+			if t.Name.Space != "" || t.Name.Local != "style" {
+				return "", fmt.Errorf("%w: mismatched end element %s", ErrInvalidImage, t.Name.Local)
+			}
+			return css.String(), nil
+		case xml.StartElement:
+			return "", fmt.Errorf("%w: markup inside style", ErrInvalidImage)
+		}
+	}
+}
+
+// safeSVGAttr decides whether an attribute is kept and returns its name as
+// written. Namespace declarations are dropped; the root element gets the
+// standard ones.
+func safeSVGAttr(attr xml.Attr) (string, bool) {
+	name, value := attr.Name, strings.TrimSpace(attr.Value)
+	switch {
+	case name.Space == "" && name.Local == "xmlns", name.Space == "xmlns":
+		return "", false
+	case name.Space == "xlink" && name.Local == "href":
+		// Only references into the document itself
+		return "xlink:href", strings.HasPrefix(value, "#")
+	case name.Space == "" && name.Local == "href":
+		return "href", strings.HasPrefix(value, "#")
+	case name.Space == "xml" && (name.Local == "space" || name.Local == "lang"):
+		return "xml:" + name.Local, true
+	case name.Space != "":
+		return "", false
+	case strings.HasPrefix(strings.ToLower(name.Local), "on"):
+		return "", false
+	}
+
+	if name.Local == "style" && !safeCSS(value) {
+		return "", false
+	}
+	if !safeSVGValue(value) {
+		return "", false
+	}
+	return name.Local, true
+}
+
+// safeSVGValue rejects script URLs and any url() that is not a fragment
+func safeSVGValue(value string) bool {
+	compact := strings.ToLower(strings.Join(strings.Fields(value), ""))
+	if strings.Contains(compact, "javascript:") || strings.Contains(compact, "vbscript:") || strings.Contains(compact, "data:") {
+		return false
+	}
+	for _, m := range cssURLPattern.FindAllStringSubmatch(value, -1) {
+		if !strings.HasPrefix(m[1], "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// safeCSS rejects style sheets that import, bind or evaluate anything
+func safeCSS(css string) bool {
+	compact := strings.ToLower(strings.Join(strings.Fields(css), ""))
+	for _, bad := range []string{"@import", "expression(", "behavior:", "-moz-binding", "</"} {
+		if strings.Contains(compact, bad) {
+			return false
+		}
+	}
+	return safeSVGValue(css)
+}
+
+// svgSize returns the intrinsic size of an SVG from its width and height
+// attributes, falling back to the viewBox and then to the browser default
+func svgSize(data []byte) (float64, float64, error) {
+	root, err := svgRoot(data)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	var width, height, vbWidth, vbHeight float64
+	for _, attr := range root.Attr {
+		if attr.Name.Space != "" {
+			continue
+		}
+		switch attr.Name.Local {
+		case "width":
+			width = svgLength(attr.Value)
+		case "height":
+			height = svgLength(attr.Value)
+		case "viewBox":
+			if f := strings.FieldsFunc(attr.Value, func(r rune) bool { return r == ' ' || r == ',' }); len(f) == 4 {
+				vbWidth, _ = strconv.ParseFloat(f[2], 64)
+				vbHeight, _ = strconv.ParseFloat(f[3], 64)
+			}
+		}
+	}
+
+	switch {
+	case width > 0 && height > 0:
+	case vbWidth > 0 && vbHeight > 0 && width > 0:
+		height = width * vbHeight / vbWidth
+	case vbWidth > 0 && vbHeight > 0 && height > 0:
+		width = height * vbWidth / vbHeight
+	case vbWidth > 0 && vbHeight > 0:
+		width, height = vbWidth, vbHeight
+	default:
+		width, height = svgDefaultWidth, svgDefaultHeight
+	}
+	return width, height, nil
+}
+
+// svgLength parses an absolute length; relative units yield 0
+func svgLength(v string) float64 {
+	m := svgLengthPattern.FindStringSubmatch(v)
+	if m == nil {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(m[1], 64)
+	return f
+}
+
+// RasterizeSVG renders an SVG so it covers (cover, fill) or fits (contain)
+// a width x height box, keeping its aspect ratio; the caller crops or scales
+// the result to the exact box. Zero sizes render at the intrinsic size. The
+// raster is shrunk as needed to stay within the configured pixel limit.
+func RasterizeSVG(data []byte, width, height int, fit string) (image.Image, error) {
+	w, h, err := svgSize(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := 1.0
+	rw, rh := float64(width)/w, float64(height)/h
+	switch {
+	case width > 0 && height > 0 && fit == FitContain:
+		ratio = math.Min(rw, rh)
+	case width > 0 && height > 0:
+		ratio = math.Max(rw, rh)
+	case width > 0:
+		ratio = rw
+	case height > 0:
+		ratio = rh
+	}
+
+	pw, ph := math.Max(1, math.Round(w*ratio)), math.Max(1, math.Round(h*ratio))
+	if l := currentLimits(); l.MaxPixels > 0 && pw*ph > float64(l.MaxPixels) {
+		shrink := math.Sqrt(float64(l.MaxPixels) / (pw * ph))
+		pw, ph = math.Max(1, math.Floor(pw*shrink)), math.Max(1, math.Floor(ph*shrink))
+	}
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+		icon.ViewBox.W, icon.ViewBox.H = w, h
+	}
+	icon.SetTarget(0, 0, pw, ph)
+
+	img := image.NewNRGBA(image.Rect(0, 0, int(pw), int(ph)))
+	scanner := rasterx.NewScannerGV(int(pw), int(ph), img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(int(pw), int(ph), scanner), 1)
+	return img, nil
+}
+
+// DecodeAt decodes an image for rendering into a width x height box. Raster
+// formats decode at their own size; SVGs are rendered directly at the size
+// needed so they stay sharp.
+func DecodeAt(data []byte, width, height int, fit string) (image.Image, error) {
+	if IsSVG(data) {
+		return RasterizeSVG(data, width, height, fit)
+	}
+	img, _, err := Decode(data)
+	return img, err
+}
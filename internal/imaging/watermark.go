@@ -0,0 +1,78 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+	PositionCenter      = "center"
+)
+
+// ValidPosition reports whether position is a known watermark position
+func ValidPosition(position string) bool {
+	switch position {
+	case PositionTopLeft, PositionTopRight, PositionBottomLeft, PositionBottomRight, PositionCenter:
+		return true
+	}
+	return false
+}
+
+// Watermark describes an overlay stamped onto public renditions
+type Watermark struct {
+	Overlay  image.Image
+	Position string
+	Opacity  float64 // 0-1
+	Scale    float64 // Overlay width as a fraction of the image width
+	MinSize  int     // Images narrower or shorter than this are left untouched
+}
+
+// ApplyWatermark draws the overlay onto a copy of img
+func ApplyWatermark(img image.Image, wm Watermark) image.Image {
+	b := img.Bounds()
+	if wm.Overlay == nil || b.Dx() < wm.MinSize || b.Dy() < wm.MinSize {
+		return img
+	}
+
+	ob := wm.Overlay.Bounds()
+	ow := max(1, int(math.Round(float64(b.Dx())*wm.Scale)))
+	oh := max(1, int(math.Round(float64(ow)*float64(ob.Dy())/float64(ob.Dx()))))
+	if oh > b.Dy() {
+		oh = b.Dy()
+		ow = max(1, int(math.Round(float64(oh)*float64(ob.Dx())/float64(ob.Dy()))))
+	}
+
+	overlay := image.NewNRGBA(image.Rect(0, 0, ow, oh))
+	draw.CatmullRom.Scale(overlay, overlay.Bounds(), wm.Overlay, ob, draw.Src, nil)
+
+	margin := int(math.Round(0.02 * float64(min(b.Dx(), b.Dy()))))
+	var at image.Point
+	switch wm.Position {
+	case PositionTopLeft:
+		at = image.Pt(margin, margin)
+	case PositionTopRight:
+		at = image.Pt(b.Dx()-ow-margin, margin)
+	case PositionBottomLeft:
+		at = image.Pt(margin, b.Dy()-oh-margin)
+	case PositionCenter:
+		at = image.Pt((b.Dx()-ow)/2, (b.Dy()-oh)/2)
+	default:
+		at = image.Pt(b.Dx()-ow-margin, b.Dy()-oh-margin)
+	}
+
+	dst := toNRGBA(img)
+	if dst == img {
+		dst = image.NewNRGBA(dst.Rect)
+		draw.Draw(dst, dst.Rect, img, b.Min, draw.Src)
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(math.Max(0, math.Min(1, wm.Opacity)) * 255))})
+	draw.DrawMask(dst, overlay.Bounds().Add(at), overlay, image.Point{}, mask, image.Point{}, draw.Over)
+	return dst
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"cdn-service/internal/services"
 	"cdn-service/internal/utils"
 	"cdn-service/package/response"
 	"github.com/gin-gonic/gin"
@@ -9,15 +10,19 @@ import (
 
 type AuthMiddleware interface {
 	Handler() gin.HandlerFunc
+	AdminHandler() gin.HandlerFunc
+	UploadHandler() gin.HandlerFunc
 }
 
 type authMiddleware struct {
-	JWTService utils.JWTService
+	JWTService         utils.JWTService
+	UploadTokenService services.UploadTokenService
 }
 
-func NewAuthMiddleware(jwtService utils.JWTService) AuthMiddleware {
+func NewAuthMiddleware(jwtService utils.JWTService, uploadTokenService services.UploadTokenService) AuthMiddleware {
 	return authMiddleware{
-		JWTService: jwtService,
+		JWTService:         jwtService,
+		UploadTokenService: uploadTokenService,
 	}
 }
 
@@ -49,3 +54,70 @@ func (a authMiddleware) Handler() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func (a authMiddleware) AdminHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("Authorization")
+		if token == "" {
+			response.SendResponse(c, http.StatusUnauthorized, "Missing token", nil, "Authorization header is required")
+			c.Abort()
+			return
+		}
+
+		_, err := a.JWTService.ValidateTokenAdmin(token)
+		if err != nil {
+			response.SendResponse(c, http.StatusForbidden, "Admin access required", nil, err.Error())
+			c.Abort()
+			return
+		}
+
+		tokenClaims, err := a.JWTService.ExtractClaims(token)
+		if err != nil {
+			response.SendResponse(c, http.StatusUnauthorized, "Invalid token claims", nil, err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Set("token", tokenClaims)
+
+		c.Next()
+	}
+}
+
+// UploadHandler accepts a user token or a presigned upload token. The scope
+// of an upload token is stored in the context for the upload endpoints to
+// enforce.
+func (a authMiddleware) UploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("Authorization")
+		if token == "" {
+			response.SendResponse(c, http.StatusUnauthorized, "Missing token", nil, "Authorization header is required")
+			c.Abort()
+			return
+		}
+
+		if _, err := a.JWTService.ValidateToken(token); err == nil {
+			tokenClaims, err := a.JWTService.ExtractClaims(token)
+			if err != nil {
+				response.SendResponse(c, http.StatusUnauthorized, "Invalid token claims", nil, err.Error())
+				c.Abort()
+				return
+			}
+			c.Set("token", tokenClaims)
+			c.Next()
+			return
+		}
+
+		scope, err := a.UploadTokenService.Verify(token)
+		if err != nil {
+			response.SendResponse(c, http.StatusUnauthorized, "Invalid token", nil, err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Set("token", &utils.TokenClaims{ClientID: scope.ClientID, Exp: scope.ExpiresAt.Unix()})
+		c.Set(utils.UploadScope, scope)
+
+		c.Next()
+	}
+}
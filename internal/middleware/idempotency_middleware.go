@@ -0,0 +1,289 @@
+package middleware
+
+import (
+	"cdn-service/internal/repository"
+	"cdn-service/internal/utils"
+	"cdn-service/models/idempotency"
+	"cdn-service/package/response"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+	ReplayedHeader    = "Idempotent-Replayed"
+
+	maxIdempotencyKey   = 255
+	maxRecordedResponse = 1 << 20
+
+	// Fingerprints of uploads and of bodies with a Content-Digest are
+	// prefixed; the others are the SHA-256 of method, path and body
+	formFingerprintPrefix   = "form:"
+	digestFingerprintPrefix = "digest:"
+)
+
+// IdempotencyMiddleware makes mutating requests carrying an Idempotency-Key
+// safe to retry. It must run after the authentication middleware.
+type IdempotencyMiddleware interface {
+	Handler() gin.HandlerFunc
+}
+
+type idempotencyMiddleware struct {
+	Repository repository.IdempotencyRepository
+	TTL        time.Duration // How long a response is replayed
+	LockTTL    time.Duration // How long an unfinished request holds its key
+	MaxBody    int64         // Bytes read to fingerprint a request that is not an upload
+}
+
+func NewIdempotencyMiddleware(idempotencyRepo repository.IdempotencyRepository, ttl, lockTTL time.Duration, maxBody int64) IdempotencyMiddleware {
+	return idempotencyMiddleware{
+		Repository: idempotencyRepo,
+		TTL:        ttl,
+		LockTTL:    lockTTL,
+		MaxBody:    maxBody,
+	}
+}
+
+// Handler claims the key of the client before the request is handled and
+// records the response afterwards. Retries get the recorded response, a
+// retry arriving while the first request runs gets 409 and a key reused for
+// a different request gets 422. Uploads are compared by their staged form,
+// other requests by their Content-Digest or else their body. Server errors
+// and uploads corrupted on the way are not recorded, so the request can be
+// retried with the same key.
+func (m idempotencyMiddleware) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" || !mutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			response.SendResponse(c, http.StatusBadRequest, "Invalid Idempotency-Key", nil, "Idempotency-Key must not be longer than 255 characters")
+			c.Abort()
+			return
+		}
+		claims, ok := utils.ExtractTokenClaims(c)
+		if !ok {
+			c.Abort()
+			return
+		}
+
+		claimed, err := m.Repository.Claim(claims.ClientID, key, &idempotency.Record{State: idempotency.StateInProgress, CreatedAt: time.Now()}, m.LockTTL)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to claim Idempotency-Key")
+			response.SendResponse(c, http.StatusInternalServerError, "Idempotency check failed", nil, err.Error())
+			c.Abort()
+			return
+		}
+		if !claimed {
+			m.replay(c, claims.ClientID, key)
+			return
+		}
+
+		body := &fingerprintBody{ReadCloser: c.Request.Body, hash: requestHash(c.Request)}
+		c.Request.Body = body
+		var staged string
+		utils.SetStagedFormCheck(c, func(form *utils.StagedForm) bool {
+			staged = formFingerprint(c, form)
+			return true
+		})
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusRequestEntityTooLarge || writer.overflow || c.GetBool(utils.ChecksumMismatch) {
+			m.release(claims.ClientID, key)
+			return
+		}
+
+		fingerprint := staged
+		if fingerprint == "" {
+			fingerprint = digestFingerprint(c.Request)
+		}
+		if fingerprint == "" {
+			// Fingerprint what the handler left unread
+			if !body.eof {
+				_, _ = io.Copy(io.Discard, io.LimitReader(body, m.MaxBody))
+			}
+			if !body.eof {
+				m.release(claims.ClientID, key)
+				return
+			}
+			fingerprint = hex.EncodeToString(body.hash.Sum(nil))
+		}
+
+		record := &idempotency.Record{
+			State:       idempotency.StateCompleted,
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body,
+			CreatedAt:   time.Now(),
+		}
+		if err := m.Repository.SaveRecord(claims.ClientID, key, record, m.TTL); err != nil {
+			log.Error().Err(err).Msgf("Failed to record response for Idempotency-Key %s", key)
+		}
+	}
+}
+
+// replay answers a request whose key was already claimed
+func (m idempotencyMiddleware) replay(c *gin.Context, clientID, key string) {
+	record, err := m.Repository.GetRecord(clientID, key)
+	if errors.Is(err, utils.ErrNoData) || (err == nil && record.State == idempotency.StateInProgress) {
+		// Expired in between counts as in progress too; the client retries
+		response.SendResponse(c, http.StatusConflict, "Request in progress", nil, "a request with this Idempotency-Key is still being processed")
+		c.Abort()
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("Failed to load Idempotency-Key")
+		response.SendResponse(c, http.StatusInternalServerError, "Idempotency check failed", nil, err.Error())
+		c.Abort()
+		return
+	}
+
+	if route, ok := strings.CutPrefix(record.Fingerprint, formFingerprintPrefix); ok {
+		if !strings.HasPrefix(route, routeHash(c)+":") {
+			keyReused(c)
+			c.Abort()
+			return
+		}
+		// An upload is compared by what it carries, which is only known
+		// once the handler staged it; the handler stops right after
+		utils.SetStagedFormCheck(c, func(form *utils.StagedForm) bool {
+			if formFingerprint(c, form) == record.Fingerprint {
+				replayRecord(c, record)
+			} else {
+				keyReused(c)
+			}
+			return false
+		})
+		c.Next()
+		return
+	}
+	defer c.Abort()
+
+	if strings.HasPrefix(record.Fingerprint, digestFingerprintPrefix) {
+		if digestFingerprint(c.Request) != record.Fingerprint {
+			keyReused(c)
+			return
+		}
+		replayRecord(c, record)
+		return
+	}
+
+	fingerprint := requestHash(c.Request)
+	if n, err := io.Copy(fingerprint, io.LimitReader(c.Request.Body, m.MaxBody+1)); err != nil || n > m.MaxBody ||
+		hex.EncodeToString(fingerprint.Sum(nil)) != record.Fingerprint {
+		keyReused(c)
+		return
+	}
+	replayRecord(c, record)
+}
+
+func replayRecord(c *gin.Context, record *idempotency.Record) {
+	c.Header(ReplayedHeader, "true")
+	c.Data(record.Status, record.ContentType, record.Body)
+}
+
+func keyReused(c *gin.Context) {
+	response.SendResponse(c, http.StatusUnprocessableEntity, "Idempotency-Key reused", nil, "this Idempotency-Key was already used for a different request")
+}
+
+// release frees a claimed key so the request can be retried
+func (m idempotencyMiddleware) release(clientID, key string) {
+	if err := m.Repository.DeleteRecord(clientID, key); err != nil {
+		log.Error().Err(err).Msgf("Failed to release Idempotency-Key %s", key)
+	}
+}
+
+func mutating(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// requestHash starts the fingerprint of a request with its method and path;
+// the body is added as it is read
+func requestHash(r *http.Request) hash.Hash {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	return h
+}
+
+// routeHash identifies the method, path and media type of a request
+func routeHash(c *gin.Context) string {
+	h := sha256.Sum256([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + " " + c.ContentType()))
+	return hex.EncodeToString(h[:])
+}
+
+// formFingerprint identifies an upload by its route and the fields and file
+// digests of its staged form, so a retry encoding the same form with another
+// multipart boundary still matches
+func formFingerprint(c *gin.Context, form *utils.StagedForm) string {
+	return formFingerprintPrefix + routeHash(c) + ":" + form.Fingerprint()
+}
+
+// digestFingerprint identifies a request by the digest of its body the
+// client sent along, empty when there is none
+func digestFingerprint(r *http.Request) string {
+	digest := r.Header.Get(utils.ContentDigestHeader)
+	if digest == "" {
+		return ""
+	}
+	h := requestHash(r)
+	_, _ = io.WriteString(h, digest)
+	return digestFingerprintPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintBody hashes the request body while the handler reads it
+type fingerprintBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	eof  bool
+}
+
+func (b *fingerprintBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// recordingWriter keeps a copy of the response body, up to a limit
+type recordingWriter struct {
+	gin.ResponseWriter
+	body     []byte
+	overflow bool
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.record(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *recordingWriter) record(p []byte) {
+	if w.overflow {
+		return
+	}
+	if len(w.body)+len(p) > maxRecordedResponse {
+		w.overflow, w.body = true, nil
+		return
+	}
+	w.body = append(w.body, p...)
+}
@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"bytes"
+	"cdn-service/internal/utils"
+	"cdn-service/models/idempotency"
+	"github.com/gin-gonic/gin"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryIdempotencyRepository keeps records in a map, without expiry
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]idempotency.Record
+}
+
+func (r *memoryIdempotencyRepository) Claim(clientID, key string, record *idempotency.Record, _ time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.records[clientID+":"+key]; ok {
+		return false, nil
+	}
+	r.records[clientID+":"+key] = *record
+	return true, nil
+}
+
+func (r *memoryIdempotencyRepository) SaveRecord(clientID, key string, record *idempotency.Record, _ time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[clientID+":"+key] = *record
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) GetRecord(clientID, key string) (*idempotency.Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[clientID+":"+key]
+	if !ok {
+		return nil, utils.ErrNoData
+	}
+	return &record, nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteRecord(clientID, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, clientID+":"+key)
+	return nil
+}
+
+// idempotencyTestRouter serves an upload route that stages its form like the
+// image controller and two other routes, counting the requests handled
+func idempotencyTestRouter(t *testing.T) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	handled := 0
+	m := NewIdempotencyMiddleware(&memoryIdempotencyRepository{records: make(map[string]idempotency.Record)}, time.Hour, time.Minute, 1<<20)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(utils.Token, &utils.TokenClaims{ClientID: "client"})
+	}, m.Handler())
+	router.POST("/upload", func(c *gin.Context) {
+		form, err := utils.StreamMultipart(c.Request, "images", t.TempDir(), utils.UploadLimits{})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer form.Cleanup()
+		if !utils.CheckStagedForm(c, form) {
+			return
+		}
+		handled++
+		c.JSON(http.StatusCreated, gin.H{"data": handled})
+	})
+	router.POST("/other", func(c *gin.Context) {
+		handled++
+		c.JSON(http.StatusCreated, gin.H{"data": handled})
+	})
+	router.POST("/json", func(c *gin.Context) {
+		var body map[string]any
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		handled++
+		c.JSON(http.StatusCreated, gin.H{"data": handled})
+	})
+	return router, &handled
+}
+
+// uploadForm encodes the same fields and files with a new random boundary on
+// every call, like a client rebuilding its form for a retry
+func uploadForm(t *testing.T, files map[string]string, fields ...string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i := 0; i+1 < len(fields); i += 2 {
+		if err := writer.WriteField(fields[i], fields[i+1]); err != nil {
+			t.Fatalf("write field: %v", err)
+		}
+	}
+	for _, name := range []string{"a.png", "b.png"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		part, err := writer.CreateFormFile("images", name)
+		if err != nil {
+			t.Fatalf("create part: %v", err)
+		}
+		_, _ = part.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close form: %v", err)
+	}
+	return &body, writer.FormDataContentType()
+}
+
+func sendIdempotent(router *gin.Engine, path, contentType string, body *bytes.Buffer, key string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, body)
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set(IdempotencyHeader, key)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestIdempotencyReplaysUploadWithNewBoundary(t *testing.T) {
+	router, handled := idempotencyTestRouter(t)
+	files := map[string]string{"a.png": "first image", "b.png": "second image"}
+
+	body, contentType := uploadForm(t, files, "atomic", "true", "duplicates", "link")
+	first := sendIdempotent(router, "/upload", contentType, body, "retry")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first upload = %d %s", first.Code, first.Body)
+	}
+
+	// Same form, new boundary and field order
+	body, retryType := uploadForm(t, files, "duplicates", "link", "atomic", "true")
+	if retryType == contentType {
+		t.Fatalf("the retry reused the boundary %s", contentType)
+	}
+	retry := sendIdempotent(router, "/upload", retryType, body, "retry")
+	if retry.Code != http.StatusCreated || retry.Header().Get(ReplayedHeader) != "true" {
+		t.Fatalf("retry = %d %s, want the replayed response", retry.Code, retry.Body)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("replayed %s, want %s", retry.Body, first.Body)
+	}
+	if *handled != 1 {
+		t.Errorf("handler ran %d times, want once", *handled)
+	}
+}
+
+func TestIdempotencyRejectsReusedKey(t *testing.T) {
+	files := map[string]string{"a.png": "first image"}
+	tests := []struct {
+		name  string
+		path  string
+		files map[string]string
+		field []string
+	}{
+		{name: "other file content", path: "/upload", files: map[string]string{"a.png": "another image"}},
+		{name: "other file name", path: "/upload", files: map[string]string{"b.png": "first image"}},
+		{name: "extra file", path: "/upload", files: map[string]string{"a.png": "first image", "b.png": "second image"}},
+		{name: "other field", path: "/upload", files: files, field: []string{"atomic", "true"}},
+		{name: "other route", path: "/other", files: files},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, handled := idempotencyTestRouter(t)
+			body, contentType := uploadForm(t, files)
+			if first := sendIdempotent(router, "/upload", contentType, body, "reused"); first.Code != http.StatusCreated {
+				t.Fatalf("first upload = %d %s", first.Code, first.Body)
+			}
+
+			body, contentType = uploadForm(t, tt.files, tt.field...)
+			if retry := sendIdempotent(router, tt.path, contentType, body, "reused"); retry.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("retry = %d %s, want 422", retry.Code, retry.Body)
+			}
+			if *handled != 1 {
+				t.Errorf("handler ran %d times, want once", *handled)
+			}
+		})
+	}
+}
+
+func TestIdempotencyReplaysJSONBody(t *testing.T) {
+	router, handled := idempotencyTestRouter(t)
+	send := func(body string) *httptest.ResponseRecorder {
+		return sendIdempotent(router, "/json", "application/json", bytes.NewBufferString(body), "json")
+	}
+
+	if first := send(`{"url":"https://example.com/a.png"}`); first.Code != http.StatusCreated {
+		t.Fatalf("first request = %d %s", first.Code, first.Body)
+	}
+	if retry := send(`{"url":"https://example.com/a.png"}`); retry.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry = %d %s, want the replayed response", retry.Code, retry.Body)
+	}
+	if other := send(`{"url":"https://example.com/b.png"}`); other.Code != http.StatusUnprocessableEntity {
+		t.Errorf("other body = %d %s, want 422", other.Code, other.Body)
+	}
+	if *handled != 1 {
+		t.Errorf("handler ran %d times, want once", *handled)
+	}
+}
+
+func TestIdempotencyComparesContentDigest(t *testing.T) {
+	router, handled := idempotencyTestRouter(t)
+	send := func(digest string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/json", strings.NewReader(`{"name":"a"}`))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(IdempotencyHeader, "digest")
+		if digest != "" {
+			request.Header.Set(utils.ContentDigestHeader, digest)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// sha-256 of {"name":"a"}
+	digest := "sha-256=:2dcZsnSAtVzUkYAg50c+cW7TVpyK2v6SbPmxC0+O8GQ=:"
+	if first := send(digest); first.Code != http.StatusCreated {
+		t.Fatalf("first request = %d %s", first.Code, first.Body)
+	}
+	if retry := send(digest); retry.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry = %d %s, want the replayed response", retry.Code, retry.Body)
+	}
+	if other := send(""); other.Code != http.StatusUnprocessableEntity {
+		t.Errorf("retry without digest = %d %s, want 422", other.Code, other.Body)
+	}
+	if *handled != 1 {
+		t.Errorf("handler ran %d times, want once", *handled)
+	}
+}
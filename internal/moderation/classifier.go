@@ -0,0 +1,89 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+const (
+	HeaderClientID  = "X-CDN-Client-ID"
+	HeaderFilename  = "X-CDN-Filename"
+	HeaderSignature = "X-CDN-Signature"
+
+	maxClassifierReply = 64 << 10
+)
+
+// Classifier sends each image to an HTTP classification service. The image
+// is POSTed as the raw request body with its content type; when a secret is
+// configured the body is signed like webhook payloads. The service answers
+// with JSON: {"decision": "approve|reject|review", "reason": "...",
+// "labels": {"nsfw": 0.02}}.
+type Classifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+type classifierReply struct {
+	Decision string             `json:"decision"`
+	Reason   string             `json:"reason"`
+	Labels   map[string]float64 `json:"labels"`
+}
+
+// NewClassifier returns a moderator calling the classifier at rawURL
+func NewClassifier(rawURL, secret string) (*Classifier, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid classifier url %q", rawURL)
+	}
+	return &Classifier{url: rawURL, secret: secret, client: &http.Client{}}, nil
+}
+
+func (c *Classifier) Review(ctx context.Context, request Request) (Verdict, error) {
+	data, err := os.ReadFile(request.Path)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", request.ContentType)
+	req.Header.Set(HeaderClientID, request.ClientID)
+	req.Header.Set(HeaderFilename, request.Filename)
+	if c.secret != "" {
+		mac := hmac.New(sha256.New, []byte(c.secret))
+		mac.Write(data)
+		req.Header.Set(HeaderSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Verdict{}, fmt.Errorf("classifier answered %d", resp.StatusCode)
+	}
+
+	var reply classifierReply
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxClassifierReply)).Decode(&reply); err != nil {
+		return Verdict{}, fmt.Errorf("invalid classifier reply: %v", err)
+	}
+	switch reply.Decision {
+	case DecisionApprove, DecisionReject, DecisionReview:
+	default:
+		return Verdict{}, fmt.Errorf("unknown classifier decision %q", reply.Decision)
+	}
+	return Verdict{Decision: reply.Decision, Reason: reply.Reason, Labels: reply.Labels}, nil
+}
@@ -0,0 +1,36 @@
+package moderation
+
+import "context"
+
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+	DecisionReview  = "review" // Leave the image pending for an admin
+)
+
+// Request identifies a stored image to moderate
+type Request struct {
+	ClientID    string
+	Filename    string
+	Path        string // Stored file
+	ContentType string
+}
+
+// Verdict is a moderator's decision on one image
+type Verdict struct {
+	Decision string
+	Reason   string
+	Labels   map[string]float64
+}
+
+// Moderator decides whether a freshly uploaded image may be served publicly
+type Moderator interface {
+	Review(ctx context.Context, request Request) (Verdict, error)
+}
+
+// Manual leaves every image pending until an admin reviews it
+type Manual struct{}
+
+func (Manual) Review(context.Context, Request) (Verdict, error) {
+	return Verdict{Decision: DecisionReview}, nil
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"cdn-service/internal/utils"
+	"cdn-service/models/alias"
+)
+
+const aliasKey = "alias"
+
+// AliasRepository stores the named aliases of each client in Redis
+type AliasRepository interface {
+	SaveAliases(a *alias.Aliases) error
+	GetAliases(clientID string) (*alias.Aliases, error)
+}
+
+type aliasRepository struct {
+	Redis utils.RedisService
+}
+
+func NewAliasRepository(redis utils.RedisService) AliasRepository {
+	return aliasRepository{Redis: redis}
+}
+
+func (r aliasRepository) SaveAliases(a *alias.Aliases) error {
+	return r.Redis.SaveData(aliasKey, a.ClientID, a)
+}
+
+func (r aliasRepository) GetAliases(clientID string) (*alias.Aliases, error) {
+	var a alias.Aliases
+	if err := r.Redis.GetData(aliasKey, clientID, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
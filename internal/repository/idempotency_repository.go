@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"cdn-service/internal/utils"
+	"cdn-service/models/idempotency"
+	"time"
+)
+
+const idempotencyKey = "idempotency"
+
+// IdempotencyRepository stores the Idempotency-Key records of each client in
+// Redis. Records expire on their own.
+type IdempotencyRepository interface {
+	// Claim stores record unless the key is already taken and reports
+	// whether it was stored
+	Claim(clientID, key string, record *idempotency.Record, ttl time.Duration) (bool, error)
+	SaveRecord(clientID, key string, record *idempotency.Record, ttl time.Duration) error
+	GetRecord(clientID, key string) (*idempotency.Record, error)
+	DeleteRecord(clientID, key string) error
+}
+
+type idempotencyRepository struct {
+	Redis utils.RedisService
+}
+
+func NewIdempotencyRepository(redis utils.RedisService) IdempotencyRepository {
+	return idempotencyRepository{Redis: redis}
+}
+
+func (r idempotencyRepository) Claim(clientID, key string, record *idempotency.Record, ttl time.Duration) (bool, error) {
+	return r.Redis.SaveDataIfAbsent(idempotencyKey, clientID+":"+key, record, ttl)
+}
+
+func (r idempotencyRepository) SaveRecord(clientID, key string, record *idempotency.Record, ttl time.Duration) error {
+	return r.Redis.SaveDataWithTTL(idempotencyKey, clientID+":"+key, record, ttl)
+}
+
+func (r idempotencyRepository) GetRecord(clientID, key string) (*idempotency.Record, error) {
+	var record idempotency.Record
+	if err := r.Redis.GetData(idempotencyKey, clientID+":"+key, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r idempotencyRepository) DeleteRecord(clientID, key string) error {
+	return r.Redis.DeleteData(idempotencyKey, clientID+":"+key)
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"cdn-service/internal/utils"
+	"cdn-service/models/metadata"
+	"errors"
+	"sort"
+)
+
+const (
+	imageExifKey     = "image_exif"
+	imageMetadataKey = "image_metadata"
+	imageIndexKey    = "images:"
+)
+
+// ImageMetadataRepository stores per-image metadata in Redis
+type ImageMetadataRepository interface {
+	SaveExif(exif *metadata.ImageExif) error
+	GetExif(clientID, filename string) (*metadata.ImageExif, error)
+	DeleteExif(clientID, filename string) error
+	SaveMetadata(meta *metadata.ImageMetadata) error
+	GetMetadata(clientID, filename string) (*metadata.ImageMetadata, error)
+	GetMetadataByClient(clientID string) ([]metadata.ImageMetadata, error)
+	DeleteMetadata(clientID, filename string) error
+}
+
+type imageMetadataRepository struct {
+	Redis utils.RedisService
+}
+
+func NewImageMetadataRepository(redis utils.RedisService) ImageMetadataRepository {
+	return imageMetadataRepository{Redis: redis}
+}
+
+func (r imageMetadataRepository) SaveExif(exif *metadata.ImageExif) error {
+	return r.Redis.SaveData(imageExifKey+":"+exif.Filename, exif.ClientID, exif)
+}
+
+func (r imageMetadataRepository) GetExif(clientID, filename string) (*metadata.ImageExif, error) {
+	var exif metadata.ImageExif
+	if err := r.Redis.GetData(imageExifKey+":"+filename, clientID, &exif); err != nil {
+		return nil, err
+	}
+	return &exif, nil
+}
+
+func (r imageMetadataRepository) DeleteExif(clientID, filename string) error {
+	return r.Redis.DeleteData(imageExifKey+":"+filename, clientID)
+}
+
+func (r imageMetadataRepository) SaveMetadata(meta *metadata.ImageMetadata) error {
+	if err := r.Redis.SaveData(imageMetadataKey+":"+meta.Filename, meta.ClientID, meta); err != nil {
+		return err
+	}
+	return r.Redis.AddToSet(imageIndexKey+meta.ClientID, meta.Filename)
+}
+
+func (r imageMetadataRepository) GetMetadata(clientID, filename string) (*metadata.ImageMetadata, error) {
+	var meta metadata.ImageMetadata
+	if err := r.Redis.GetData(imageMetadataKey+":"+filename, clientID, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// GetMetadataByClient returns the records of all indexed images of a client, newest first
+func (r imageMetadataRepository) GetMetadataByClient(clientID string) ([]metadata.ImageMetadata, error) {
+	filenames, err := r.Redis.GetSetMembers(imageIndexKey + clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]metadata.ImageMetadata, 0, len(filenames))
+	for _, filename := range filenames {
+		meta, err := r.GetMetadata(clientID, filename)
+		if errors.Is(err, utils.ErrNoData) {
+			_ = r.Redis.RemoveFromSet(imageIndexKey+clientID, filename)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, *meta)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].UploadedAt.After(records[j].UploadedAt)
+	})
+	return records, nil
+}
+
+func (r imageMetadataRepository) DeleteMetadata(clientID, filename string) error {
+	if err := r.Redis.DeleteData(imageMetadataKey+":"+filename, clientID); err != nil {
+		return err
+	}
+	return r.Redis.RemoveFromSet(imageIndexKey+clientID, filename)
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"cdn-service/internal/utils"
+	"cdn-service/models/metadata"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	moderationKey      = "moderation"
+	moderationStateKey = "moderation:state:"
+)
+
+var moderationStates = []string{metadata.ModerationPending, metadata.ModerationApproved, metadata.ModerationRejected}
+
+// ModerationRepository stores the moderation records of images in Redis,
+// with one index per state ordered by when images entered it
+type ModerationRepository interface {
+	SaveModeration(m *metadata.Moderation) error
+	GetModeration(clientID, filename string) (*metadata.Moderation, error)
+	ListModeration(state string, limit int64) ([]metadata.Moderation, error)
+	DeleteModeration(clientID, filename string) error
+}
+
+type moderationRepository struct {
+	Redis utils.RedisService
+}
+
+func NewModerationRepository(redis utils.RedisService) ModerationRepository {
+	return moderationRepository{Redis: redis}
+}
+
+func (r moderationRepository) SaveModeration(m *metadata.Moderation) error {
+	if err := r.Redis.SaveData(moderationKey+":"+m.Filename, m.ClientID, m); err != nil {
+		return err
+	}
+	member := m.ClientID + "/" + m.Filename
+	for _, state := range moderationStates {
+		if state != m.State {
+			if _, err := r.Redis.RemoveFromSortedSet(moderationStateKey+state, member); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Redis.AddToSortedSet(moderationStateKey+m.State, member, float64(m.UpdatedAt.Unix()))
+}
+
+func (r moderationRepository) GetModeration(clientID, filename string) (*metadata.Moderation, error) {
+	var m metadata.Moderation
+	if err := r.Redis.GetData(moderationKey+":"+filename, clientID, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListModeration returns up to limit records of a state, oldest first.
+// Index entries whose record is gone are skipped.
+func (r moderationRepository) ListModeration(state string, limit int64) ([]metadata.Moderation, error) {
+	members, err := r.Redis.GetSortedSetByScore(moderationStateKey+state, float64(time.Now().Unix()+1), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]metadata.Moderation, 0, len(members))
+	for _, member := range members {
+		clientID, filename, ok := strings.Cut(member, "/")
+		if !ok {
+			continue
+		}
+		m, err := r.GetModeration(clientID, filename)
+		if errors.Is(err, utils.ErrNoData) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		items = append(items, *m)
+	}
+	return items, nil
+}
+
+func (r moderationRepository) DeleteModeration(clientID, filename string) error {
+	member := clientID + "/" + filename
+	for _, state := range moderationStates {
+		if _, err := r.Redis.RemoveFromSortedSet(moderationStateKey+state, member); err != nil {
+			return err
+		}
+	}
+	return r.Redis.DeleteData(moderationKey+":"+filename, clientID)
+}
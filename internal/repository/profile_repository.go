@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"cdn-service/internal/utils"
+	"cdn-service/models/profile"
+)
+
+const profileHistoryKey = "profile_history"
+
+// ProfileRepository stores the profile photo history of each client in Redis
+type ProfileRepository interface {
+	SaveHistory(h *profile.History) error
+	GetHistory(clientID string) (*profile.History, error)
+}
+
+type profileRepository struct {
+	Redis utils.RedisService
+}
+
+func NewProfileRepository(redis utils.RedisService) ProfileRepository {
+	return profileRepository{Redis: redis}
+}
+
+func (r profileRepository) SaveHistory(h *profile.History) error {
+	return r.Redis.SaveData(profileHistoryKey, h.ClientID, h)
+}
+
+func (r profileRepository) GetHistory(clientID string) (*profile.History, error) {
+	var h profile.History
+	if err := r.Redis.GetData(profileHistoryKey, clientID, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"cdn-service/internal/utils"
+	"time"
+)
+
+const uploadTokenUsageKey = "upload_token_usage"
+
+// UploadTokenRepository counts the files uploaded with each presigned upload
+// token in Redis. Counters expire together with their token.
+type UploadTokenRepository interface {
+	AddUsage(tokenID string, count int, ttl time.Duration) (int64, error)
+}
+
+type uploadTokenRepository struct {
+	Redis utils.RedisService
+}
+
+func NewUploadTokenRepository(redis utils.RedisService) UploadTokenRepository {
+	return uploadTokenRepository{Redis: redis}
+}
+
+func (r uploadTokenRepository) AddUsage(tokenID string, count int, ttl time.Duration) (int64, error) {
+	return r.Redis.IncrementCounter(uploadTokenUsageKey, tokenID, int64(count), ttl)
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"cdn-service/internal/utils"
+	"cdn-service/models/watermark"
+)
+
+const watermarkKey = "watermark"
+
+// WatermarkRepository stores the per-client watermark configuration in Redis
+type WatermarkRepository interface {
+	SaveWatermark(w *watermark.Watermark) error
+	GetWatermark(clientID string) (*watermark.Watermark, error)
+	DeleteWatermark(clientID string) error
+}
+
+type watermarkRepository struct {
+	Redis utils.RedisService
+}
+
+func NewWatermarkRepository(redis utils.RedisService) WatermarkRepository {
+	return watermarkRepository{Redis: redis}
+}
+
+func (r watermarkRepository) SaveWatermark(w *watermark.Watermark) error {
+	return r.Redis.SaveData(watermarkKey, w.ClientID, w)
+}
+
+func (r watermarkRepository) GetWatermark(clientID string) (*watermark.Watermark, error) {
+	var w watermark.Watermark
+	if err := r.Redis.GetData(watermarkKey, clientID, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r watermarkRepository) DeleteWatermark(clientID string) error {
+	return r.Redis.DeleteData(watermarkKey, clientID)
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"cdn-service/internal/utils"
+	"cdn-service/models/webhook"
+	"errors"
+	"time"
+)
+
+const (
+	webhookKey         = "webhook"
+	webhookIndexKey    = "webhooks:"
+	deliveryKey        = "webhook_delivery"
+	deliveryLogKey     = "webhook_deliveries:"
+	pendingDeliveryKey = "webhook_pending"
+	deliveryLogLimit   = 100
+)
+
+// WebhookRepository persists webhook registrations and their delivery log in Redis
+type WebhookRepository interface {
+	SaveWebhook(w *webhook.Webhook) error
+	GetWebhook(clientID, webhookID string) (*webhook.Webhook, error)
+	GetWebhooksByClient(clientID string) ([]webhook.Webhook, error)
+	DeleteWebhook(clientID, webhookID string) error
+	SaveDelivery(d *webhook.Delivery) error
+	AppendDeliveryLog(d *webhook.Delivery) error
+	GetDelivery(deliveryID string) (*webhook.Delivery, error)
+	GetDeliveriesByWebhook(webhookID string, limit int64) ([]webhook.Delivery, error)
+	SchedulePending(deliveryID string, at time.Time) error
+	ClaimDue(now time.Time, lease time.Duration, limit int64) ([]string, error)
+	RemovePending(deliveryID string) error
+}
+
+type webhookRepository struct {
+	Redis utils.RedisService
+}
+
+func NewWebhookRepository(redis utils.RedisService) WebhookRepository {
+	return webhookRepository{Redis: redis}
+}
+
+func (r webhookRepository) SaveWebhook(w *webhook.Webhook) error {
+	if err := r.Redis.SaveData(webhookKey+":"+w.ID, w.ClientID, w); err != nil {
+		return err
+	}
+	return r.Redis.AddToSet(webhookIndexKey+w.ClientID, w.ID)
+}
+
+func (r webhookRepository) GetWebhook(clientID, webhookID string) (*webhook.Webhook, error) {
+	var w webhook.Webhook
+	if err := r.Redis.GetData(webhookKey+":"+webhookID, clientID, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r webhookRepository) GetWebhooksByClient(clientID string) ([]webhook.Webhook, error) {
+	ids, err := r.Redis.GetSetMembers(webhookIndexKey + clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]webhook.Webhook, 0, len(ids))
+	for _, id := range ids {
+		w, err := r.GetWebhook(clientID, id)
+		if errors.Is(err, utils.ErrNoData) {
+			_ = r.Redis.RemoveFromSet(webhookIndexKey+clientID, id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, nil
+}
+
+func (r webhookRepository) DeleteWebhook(clientID, webhookID string) error {
+	if err := r.Redis.DeleteData(webhookKey+":"+webhookID, clientID); err != nil {
+		return err
+	}
+	return r.Redis.RemoveFromSet(webhookIndexKey+clientID, webhookID)
+}
+
+func (r webhookRepository) SaveDelivery(d *webhook.Delivery) error {
+	return r.Redis.SaveData(deliveryKey, d.ID, d)
+}
+
+// AppendDeliveryLog records the delivery in the webhook's capped delivery log
+func (r webhookRepository) AppendDeliveryLog(d *webhook.Delivery) error {
+	return r.Redis.PushToList(deliveryLogKey+d.WebhookID, d.ID, deliveryLogLimit)
+}
+
+func (r webhookRepository) GetDelivery(deliveryID string) (*webhook.Delivery, error) {
+	var d webhook.Delivery
+	if err := r.Redis.GetData(deliveryKey, deliveryID, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r webhookRepository) GetDeliveriesByWebhook(webhookID string, limit int64) ([]webhook.Delivery, error) {
+	ids, err := r.Redis.GetList(deliveryLogKey+webhookID, 0, limit-1)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]webhook.Delivery, 0, len(ids))
+	for _, id := range ids {
+		d, err := r.GetDelivery(id)
+		if errors.Is(err, utils.ErrNoData) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, nil
+}
+
+// SchedulePending queues a delivery attempt at the given time
+func (r webhookRepository) SchedulePending(deliveryID string, at time.Time) error {
+	return r.Redis.AddToSortedSet(pendingDeliveryKey, deliveryID, float64(at.Unix()))
+}
+
+// ClaimDue returns deliveries whose attempt time has passed. Removal from the
+// pending set acts as the claim, so concurrent workers never pick up the same
+// delivery twice; claimed deliveries are immediately re-queued after the lease
+// so an attempt interrupted by a restart is retried instead of lost.
+func (r webhookRepository) ClaimDue(now time.Time, lease time.Duration, limit int64) ([]string, error) {
+	ids, err := r.Redis.GetSortedSetByScore(pendingDeliveryKey, float64(now.Unix()), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := make([]string, 0, len(ids))
+	for _, id := range ids {
+		ok, err := r.Redis.RemoveFromSortedSet(pendingDeliveryKey, id)
+		if err != nil {
+			return claimed, err
+		}
+		if !ok {
+			continue
+		}
+		if err := r.SchedulePending(id, now.Add(lease)); err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, id)
+	}
+	return claimed, nil
+}
+
+// RemovePending drops a delivery from the pending queue once it is settled
+func (r webhookRepository) RemovePending(deliveryID string) error {
+	_, err := r.Redis.RemoveFromSortedSet(pendingDeliveryKey, deliveryID)
+	return err
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"cdn-service/config"
+	"cdn-service/internal/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func AliasRoutes(r *gin.Engine, middleware config.Middleware, controller controller.AliasController) {
+
+	routerGroup := r.Group("/v1/aliases")
+	routerGroup.Use(middleware.AuthMiddleware.Handler(), middleware.IdempotencyMiddleware.Handler())
+	{
+		routerGroup.GET("", controller.ListAliases)
+		routerGroup.GET("/:alias", controller.GetAlias)
+		routerGroup.PUT("/:alias", controller.SetAlias)
+		routerGroup.DELETE("/:alias", controller.DeleteAlias)
+	}
+}
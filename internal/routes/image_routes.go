@@ -11,10 +11,33 @@ func ImageRoutes(r *gin.Engine, middleware config.Middleware, controller control
 	routerGroup := r.Group("/v1")
 	{
 		routerGroup.GET("/cdn/:clientID/:filename", controller.GetImage)
+		routerGroup.GET("/cdn/:clientID/:filename/:preset", controller.GetImageVariant)
+		routerGroup.GET("/images/:clientID/:filename/meta", controller.GetImageMetadata)
 	}
-	routerGroup.Use(middleware.AuthMiddleware.Handler())
+	adminGroup := r.Group("/v1/admin")
+	adminGroup.Use(middleware.AuthMiddleware.AdminHandler(), middleware.IdempotencyMiddleware.Handler())
+	{
+		adminGroup.POST("/images/backfill", controller.BackfillMetadata)
+	}
+	// Also open to presigned upload tokens
+	uploadGroup := r.Group("/v1")
+	uploadGroup.Use(middleware.AuthMiddleware.UploadHandler(), middleware.IdempotencyMiddleware.Handler())
+	{
+		uploadGroup.POST("/upload", controller.UploadImages)
+		uploadGroup.POST("/upload/base64", controller.UploadImageJSON)
+	}
+	routerGroup.Use(middleware.AuthMiddleware.Handler(), middleware.IdempotencyMiddleware.Handler())
 	{
 		routerGroup.POST("/upload-photo-profile", controller.UploadPhotoProfile)
-		routerGroup.POST("/upload", controller.UploadImages)
+		routerGroup.POST("/upload-photo-profile/base64", controller.UploadPhotoProfileJSON)
+		routerGroup.POST("/upload/from-url", controller.UploadFromURL)
+		routerGroup.GET("/images", controller.ListImages)
+		routerGroup.POST("/images/duplicates", controller.FindDuplicatesOf)
+		routerGroup.GET("/images/:clientID/:filename/duplicates", controller.FindDuplicates)
+		routerGroup.GET("/images/:clientID/:filename/exif", controller.GetImageExif)
+		routerGroup.PUT("/images/:clientID/:filename/focus", controller.SetImageFocus)
+		routerGroup.DELETE("/images/:clientID/:filename/focus", controller.ClearImageFocus)
+		routerGroup.POST("/images/:clientID/:filename/sign", controller.SignImageURL)
+		routerGroup.DELETE("/images/:clientID/:filename", controller.DeleteImage)
 	}
 }
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"cdn-service/config"
+	"cdn-service/internal/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func ModerationRoutes(r *gin.Engine, middleware config.Middleware, controller controller.ModerationController) {
+
+	adminGroup := r.Group("/v1/admin/moderation")
+	adminGroup.Use(middleware.AuthMiddleware.AdminHandler(), middleware.IdempotencyMiddleware.Handler())
+	{
+		adminGroup.GET("", controller.ListModeration)
+		adminGroup.POST("/:clientID/:filename/approve", controller.ApproveImage)
+		adminGroup.POST("/:clientID/:filename/reject", controller.RejectImage)
+	}
+}
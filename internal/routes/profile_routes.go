@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"cdn-service/config"
+	"cdn-service/internal/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func ProfileRoutes(r *gin.Engine, middleware config.Middleware, controller controller.ProfileController) {
+
+	routerGroup := r.Group("/v1/profile")
+	{
+		routerGroup.GET("/:clientID/current", controller.GetCurrentProfile)
+		routerGroup.GET("/:clientID/current/:preset", controller.GetCurrentProfileVariant)
+	}
+	routerGroup.Use(middleware.AuthMiddleware.Handler(), middleware.IdempotencyMiddleware.Handler())
+	{
+		routerGroup.GET("/history", controller.GetProfileHistory)
+		routerGroup.POST("/history/:filename/restore", controller.RestoreProfilePhoto)
+		routerGroup.DELETE("/history", controller.PurgeProfileHistory)
+	}
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"cdn-service/config"
+	"cdn-service/internal/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func UploadTokenRoutes(r *gin.Engine, middleware config.Middleware, controller controller.UploadTokenController) {
+
+	routerGroup := r.Group("/v1/upload-tokens")
+	routerGroup.Use(middleware.AuthMiddleware.Handler(), middleware.IdempotencyMiddleware.Handler())
+	{
+		routerGroup.POST("", controller.MintUploadToken)
+	}
+}
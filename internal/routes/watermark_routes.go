@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"cdn-service/config"
+	"cdn-service/internal/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func WatermarkRoutes(r *gin.Engine, middleware config.Middleware, controller controller.WatermarkController) {
+
+	routerGroup := r.Group("/v1/watermark")
+	routerGroup.Use(middleware.AuthMiddleware.Handler(), middleware.IdempotencyMiddleware.Handler())
+	{
+		routerGroup.PUT("", controller.SetWatermark)
+		routerGroup.GET("", controller.GetWatermark)
+		routerGroup.DELETE("", controller.DeleteWatermark)
+	}
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"cdn-service/config"
+	"cdn-service/internal/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func WebhookRoutes(r *gin.Engine, middleware config.Middleware, controller controller.WebhookController) {
+
+	routerGroup := r.Group("/v1/webhooks")
+	routerGroup.Use(middleware.AuthMiddleware.Handler(), middleware.IdempotencyMiddleware.Handler())
+	{
+		routerGroup.POST("", controller.RegisterWebhook)
+		routerGroup.GET("", controller.GetWebhooks)
+		routerGroup.PUT("/:webhookID", controller.UpdateWebhook)
+		routerGroup.DELETE("/:webhookID", controller.DeleteWebhook)
+		routerGroup.GET("/:webhookID/deliveries", controller.GetDeliveries)
+		routerGroup.POST("/:webhookID/deliveries/:deliveryID/redeliver", controller.Redeliver)
+	}
+}
@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	clamdChunkSize = 64 << 10
+	maxClamdReply  = 4 << 10
+)
+
+// Clamd scans files with a ClamAV daemon using the INSTREAM command: the
+// content is sent as length-prefixed chunks over one connection, terminated
+// by an empty chunk, and clamd answers with a single verdict line.
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd returns a scanner talking to clamd at address, either
+// tcp://host:port or unix:///path/to/clamd.ctl. A bare host:port is TCP and
+// a bare absolute path a unix socket. timeout bounds a whole scan.
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	c := &Clamd{timeout: timeout}
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		c.network, c.address = "tcp", strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "unix://"):
+		c.network, c.address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "/"):
+		c.network, c.address = "unix", address
+	default:
+		c.network, c.address = "tcp", address
+	}
+	if c.network == "tcp" {
+		if _, _, err := net.SplitHostPort(c.address); err != nil {
+			return nil, fmt.Errorf("invalid clamd address %q: %v", address, err)
+		}
+	} else if c.address == "" {
+		return nil, fmt.Errorf("invalid clamd address %q", address)
+	}
+	return c, nil
+}
+
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := stream(conn, r); err != nil {
+		// clamd closes the connection when the stream exceeds its limit;
+		// its reply says so better than the broken pipe
+		if reply, replyErr := readReply(conn); replyErr == nil {
+			return parseReply(reply)
+		}
+		return Result{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return parseReply(reply)
+}
+
+// stream sends the INSTREAM command followed by the content in chunks
+func stream(conn net.Conn, r io.Reader) error {
+	writer := bufio.NewWriterSize(conn, clamdChunkSize+4)
+	if _, err := writer.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := writer.Write(size); err != nil {
+				return err
+			}
+			if _, err := writer.Write(chunk[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := writer.Write(size); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// readReply reads the NUL terminated answer of a z-prefixed command
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(io.LimitReader(conn, maxClamdReply)).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// parseReply interprets "stream: OK", "stream: <signature> FOUND" and
+// "<message> ERROR"
+func parseReply(reply string) (Result, error) {
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("%w: clamd answered %q", ErrUnavailable, reply)
+}
@@ -0,0 +1,195 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd answers INSTREAM commands like clamd does: it reads the chunks,
+// then writes reply. Streams longer than limit are cut off with clamd's size
+// limit error, without reading the rest.
+type fakeClamd struct {
+	reply    string
+	limit    int
+	received chan []byte
+}
+
+// serve starts the fake on a new listener and returns its address
+func (f *fakeClamd) serve(t *testing.T, network string) string {
+	t.Helper()
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "clamd.sock")
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	f.received = make(chan []byte, 1)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	if network == "unix" {
+		return "unix://" + address
+	}
+	return listener.Addr().String()
+}
+
+func (f *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var content bytes.Buffer
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return
+		}
+		n := int(binary.BigEndian.Uint32(size))
+		if n == 0 {
+			break
+		}
+		if f.limit > 0 && content.Len()+n > f.limit {
+			_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+		if _, err := io.CopyN(&content, reader, int64(n)); err != nil {
+			return
+		}
+	}
+	f.received <- content.Bytes()
+	_, _ = conn.Write([]byte(f.reply + "\x00"))
+}
+
+func TestClamdScan(t *testing.T) {
+	// Larger than a chunk, so the content is split
+	content := bytes.Repeat([]byte("cdn-service "), 20000)
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    Result
+		wantErr error
+	}{
+		{name: "clean", reply: "stream: OK", want: Result{}},
+		{name: "infected", reply: "stream: Eicar-Test-Signature FOUND", want: Result{Infected: true, Signature: "Eicar-Test-Signature"}},
+		{name: "error reply", reply: "stream: Can't allocate memory ERROR", wantErr: ErrUnavailable},
+		{name: "unknown reply", reply: "PONG", wantErr: ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeClamd{reply: tt.reply}
+			clamd, err := NewClamd(fake.serve(t, "tcp"), 5*time.Second)
+			if err != nil {
+				t.Fatalf("NewClamd: %v", err)
+			}
+
+			got, err := clamd.Scan(context.Background(), bytes.NewReader(content))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Scan error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Scan = %+v, want %+v", got, tt.want)
+			}
+			if received := <-fake.received; !bytes.Equal(received, content) {
+				t.Errorf("clamd received %d bytes, want %d", len(received), len(content))
+			}
+		})
+	}
+}
+
+func TestClamdScanOversizedStream(t *testing.T) {
+	fake := &fakeClamd{reply: "stream: OK", limit: clamdChunkSize}
+	clamd, err := NewClamd(fake.serve(t, "unix"), 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClamd: %v", err)
+	}
+
+	// Far more than the socket buffers hold, so the write breaks
+	_, err = clamd.Scan(context.Background(), io.LimitReader(zeroReader{}, 32<<20))
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Scan error = %v, want %v", err, ErrUnavailable)
+	}
+	if !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("Scan error = %v, want clamd's size limit reply", err)
+	}
+}
+
+func TestClamdScanConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	clamd, err := NewClamd("tcp://"+address, time.Second)
+	if err != nil {
+		t.Fatalf("NewClamd: %v", err)
+	}
+	if _, err := clamd.Scan(context.Background(), strings.NewReader("content")); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Scan error = %v, want %v", err, ErrUnavailable)
+	}
+}
+
+func TestNewClamd(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		target  string
+		wantErr bool
+	}{
+		{address: "tcp://clamd:3310", network: "tcp", target: "clamd:3310"},
+		{address: "clamd:3310", network: "tcp", target: "clamd:3310"},
+		{address: "unix:///run/clamd.ctl", network: "unix", target: "/run/clamd.ctl"},
+		{address: "/run/clamd.ctl", network: "unix", target: "/run/clamd.ctl"},
+		{address: "clamd", wantErr: true},
+		{address: "unix://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			clamd, err := NewClamd(tt.address, time.Second)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewClamd(%q) succeeded, want an error", tt.address)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewClamd(%q): %v", tt.address, err)
+			}
+			if clamd.network != tt.network || clamd.address != tt.target {
+				t.Errorf("NewClamd(%q) = %s %s, want %s %s", tt.address, clamd.network, clamd.address, tt.network, tt.target)
+			}
+		})
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,29 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrUnavailable is returned when a file could not be scanned, whatever the
+// reason: the scanner is down, too slow or refused the stream
+var ErrUnavailable = errors.New("scanner unavailable")
+
+// Result is the verdict on one scanned file
+type Result struct {
+	Infected  bool
+	Signature string // Name of the detected threat
+}
+
+// Scanner checks uploaded content for malware
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Noop accepts every file without looking at it
+type Noop struct{}
+
+func (Noop) Scan(context.Context, io.Reader) (Result, error) {
+	return Result{}, nil
+}
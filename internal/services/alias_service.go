@@ -0,0 +1,191 @@
+package services
+
+import (
+	response "cdn-service/internal/dto/out"
+	"cdn-service/internal/repository"
+	"cdn-service/internal/utils"
+	"cdn-service/models/alias"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AliasProfile always resolves to the client's current profile photo
+const AliasProfile = "profile"
+
+var (
+	ErrAliasNotFound = errors.New("alias not found")
+	ErrInvalidAlias  = errors.New("invalid alias")
+)
+
+var aliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// AliasService manages stable per-client names that resolve to whichever
+// image they currently point at
+type AliasService interface {
+	SetAlias(clientID, name, filename string) (response.AliasResponse, error)
+	GetAlias(clientID, name string) (response.AliasResponse, error)
+	ListAliases(clientID string) ([]response.AliasResponse, error)
+	DeleteAlias(clientID, name string) error
+	Resolve(clientID, name string) (string, error)
+}
+
+type aliasService struct {
+	AliasRepository repository.AliasRepository
+	ImageService    ImageService
+	ProfileService  ProfileService
+
+	mu sync.Mutex
+}
+
+// NewAliasService initializes the service
+func NewAliasService(aliasRepository repository.AliasRepository, imageService ImageService, profileService ProfileService) AliasService {
+	return &aliasService{
+		AliasRepository: aliasRepository,
+		ImageService:    imageService,
+		ProfileService:  profileService,
+	}
+}
+
+// SetAlias creates or moves an alias. The target must be a stored image of
+// the same client.
+func (s *aliasService) SetAlias(clientID, name, filename string) (response.AliasResponse, error) {
+	if err := validAlias(name); err != nil {
+		return response.AliasResponse{}, err
+	}
+	if name == AliasProfile {
+		return response.AliasResponse{}, fmt.Errorf("%w: %q follows the current profile photo and cannot be set", ErrInvalidAlias, AliasProfile)
+	}
+	if _, err := s.ImageService.GetImage(filename, clientID); err != nil {
+		return response.AliasResponse{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases, err := s.load(clientID)
+	if err != nil {
+		return response.AliasResponse{}, err
+	}
+	entry := alias.Alias{Name: name, Filename: filename, UpdatedAt: time.Now()}
+	aliases.Entries[name] = entry
+	if err := s.AliasRepository.SaveAliases(aliases); err != nil {
+		return response.AliasResponse{}, err
+	}
+	return toAliasResponse(clientID, entry), nil
+}
+
+// GetAlias returns an alias and its current target
+func (s *aliasService) GetAlias(clientID, name string) (response.AliasResponse, error) {
+	entry, err := s.entry(clientID, name)
+	if err != nil {
+		return response.AliasResponse{}, err
+	}
+	return toAliasResponse(clientID, entry), nil
+}
+
+// ListAliases returns the client's aliases sorted by name
+func (s *aliasService) ListAliases(clientID string) ([]response.AliasResponse, error) {
+	aliases, err := s.load(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]response.AliasResponse, 0, len(aliases.Entries)+1)
+	if profile, err := s.GetAlias(clientID, AliasProfile); err == nil {
+		result = append(result, profile)
+	}
+	for _, entry := range aliases.Entries {
+		result = append(result, toAliasResponse(clientID, entry))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// DeleteAlias removes an alias. The image it pointed at is kept.
+func (s *aliasService) DeleteAlias(clientID, name string) error {
+	if name == AliasProfile {
+		return fmt.Errorf("%w: %q cannot be deleted", ErrInvalidAlias, AliasProfile)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases, err := s.load(clientID)
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases.Entries[name]; !ok {
+		return ErrAliasNotFound
+	}
+	delete(aliases.Entries, name)
+	return s.AliasRepository.SaveAliases(aliases)
+}
+
+// Resolve returns the filename an alias currently points at
+func (s *aliasService) Resolve(clientID, name string) (string, error) {
+	entry, err := s.entry(clientID, name)
+	if err != nil {
+		return "", err
+	}
+	return entry.Filename, nil
+}
+
+func (s *aliasService) entry(clientID, name string) (alias.Alias, error) {
+	if name == AliasProfile {
+		filename, updatedAt, err := s.ProfileService.Current(clientID)
+		if errors.Is(err, ErrNoProfilePhoto) {
+			return alias.Alias{}, ErrAliasNotFound
+		} else if err != nil {
+			return alias.Alias{}, err
+		}
+		return alias.Alias{Name: name, Filename: filename, UpdatedAt: updatedAt}, nil
+	}
+
+	aliases, err := s.load(clientID)
+	if err != nil {
+		return alias.Alias{}, err
+	}
+	entry, ok := aliases.Entries[name]
+	if !ok {
+		return alias.Alias{}, ErrAliasNotFound
+	}
+	return entry, nil
+}
+
+func (s *aliasService) load(clientID string) (*alias.Aliases, error) {
+	aliases, err := s.AliasRepository.GetAliases(clientID)
+	if errors.Is(err, utils.ErrNoData) {
+		aliases = &alias.Aliases{ClientID: clientID}
+	} else if err != nil {
+		return nil, err
+	}
+	if aliases.Entries == nil {
+		aliases.Entries = make(map[string]alias.Alias)
+	}
+	return aliases, nil
+}
+
+func validAlias(name string) error {
+	if !aliasPattern.MatchString(name) {
+		return fmt.Errorf("%w: use 1-64 lowercase letters, digits, '.', '_' or '-'", ErrInvalidAlias)
+	}
+	return nil
+}
+
+func toAliasResponse(clientID string, a alias.Alias) response.AliasResponse {
+	return response.AliasResponse{
+		Name:      a.Name,
+		URL:       AliasURL(clientID, a.Name),
+		ImageURL:  fmt.Sprintf("/cdn/%s/%s", clientID, a.Filename),
+		UpdatedAt: a.UpdatedAt,
+	}
+}
+
+// AliasURL is the stable URL of an alias
+func AliasURL(clientID, name string) string {
+	return fmt.Sprintf("/cdn/%s/@%s", clientID, name)
+}
@@ -1,125 +1,200 @@
 package services
 
 import (
+	"bytes"
+	"cdn-service/internal/dto/in"
 	response "cdn-service/internal/dto/out"
+	"cdn-service/internal/imaging"
+	"cdn-service/internal/repository"
 	"cdn-service/internal/utils"
+	"cdn-service/models/metadata"
+	"cdn-service/models/webhook"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
-	"io"
-	"mime/multipart"
+	"image"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // ImageService defines the interface for managing asset categories
 type ImageService interface {
-	UploadPhotoProfile(files *multipart.FileHeader, clientID string) (response.ImageResponse, error)
-	UploadImages(files []*multipart.FileHeader, clientID string) ([]response.ImageResponse, error)
+	StagingDir(clientID, scope string) string
+	UploadPhotoProfile(file in.UploadFile, clientID string, options in.UploadOptions) (response.ImageResponse, error)
+	UploadImages(files []in.UploadFile, clientID string, options in.UploadOptions) ([]response.UploadResult, error)
+	UploadImage(file in.UploadFile, clientID string, options in.UploadOptions) (response.ImageResponse, error)
 	GetImage(imageUrl, clientID string) (*string, error)
+	ListImages(clientID string) ([]response.ImageResponse, error)
+	GetOriginalImage(filename, clientID string, public bool) (*string, error)
+	GetImageVariant(filename, clientID, preset string, public bool) (*string, error)
+	GetResizedImage(filename, clientID string, request in.ResizeRequest, public bool) (*string, error)
+	SetImageFocus(filename, clientID string, request in.FocusRequest) (response.ImageMetadataResponse, error)
+	ClearImageFocus(filename, clientID string) error
+	GetImageExif(filename, clientID string) (response.ImageExifResponse, error)
+	GetImageMetadata(filename, clientID string, owner bool) (response.ImageMetadataResponse, error)
+	BackfillMetadata() (response.BackfillResponse, error)
+	FindDuplicates(filename, clientID string, request in.DuplicateRequest) ([]response.DuplicateResponse, error)
+	FindDuplicatesOf(file in.UploadFile, clientID string, request in.DuplicateRequest) ([]response.DuplicateResponse, error)
+	DeleteImages(clientID string, images []string) ([]string, []string)
 }
 
+var (
+	ErrImageNotFound   = errors.New("file not found")
+	ErrInvalidFocus    = errors.New("invalid focus")
+	ErrDuplicateImage  = errors.New("near-duplicate of a stored image")
+	ErrInvalidDistance = errors.New("invalid distance")
+	ErrBatchRolledBack = errors.New("upload batch rolled back")
+	ErrTypeNotAllowed  = errors.New("image type not allowed")
+)
+
 // imageService implements ImageService
 type imageService struct {
-	Redis            utils.RedisService
-	UploadDir        string
-	ProfileUploadDir string
+	Redis                   utils.RedisService
+	ImageMetadataRepository repository.ImageMetadataRepository
+	WebhookService          WebhookService
+	VariantService          VariantService
+	WatermarkService        WatermarkService
+	ProfileService          ProfileService
+	ScanService             ScanService
+	ModerationService       ModerationService
+	Pool                    *imaging.Pool
+	UploadDir               string
+	ProfileUploadDir        string
+	DuplicateDistance       int
+	ProfileOptions          imaging.ProfileOptions
+	UploadWorkers           int
 }
 
 // NewImageService initializes the service
-func NewImageService(redis utils.RedisService, uploadDir string, profileUploadDir string) ImageService {
+func NewImageService(redis utils.RedisService, imageMetadataRepository repository.ImageMetadataRepository, webhookService WebhookService, variantService VariantService, watermarkService WatermarkService, profileService ProfileService, scanService ScanService, moderationService ModerationService, pool *imaging.Pool, uploadDir string, profileUploadDir string, duplicateDistance int, profileOptions imaging.ProfileOptions, uploadWorkers int) ImageService {
+	if uploadWorkers < 1 {
+		uploadWorkers = 1
+	}
 	return &imageService{
-		Redis:            redis,
-		UploadDir:        uploadDir,
-		ProfileUploadDir: profileUploadDir,
+		Redis:                   redis,
+		ImageMetadataRepository: imageMetadataRepository,
+		WebhookService:          webhookService,
+		VariantService:          variantService,
+		WatermarkService:        watermarkService,
+		ProfileService:          profileService,
+		ScanService:             scanService,
+		ModerationService:       moderationService,
+		Pool:                    pool,
+		UploadDir:               uploadDir,
+		ProfileUploadDir:        profileUploadDir,
+		DuplicateDistance:       duplicateDistance,
+		ProfileOptions:          profileOptions,
+		UploadWorkers:           uploadWorkers,
 	}
 }
 
-// UploadPhotoProfile handles the upload of a single photo profile
-func (s *imageService) UploadPhotoProfile(file *multipart.FileHeader, clientID string) (response.ImageResponse, error) {
-	uploadBaseDir := s.ProfileUploadDir
-	if uploadBaseDir == "" {
-		uploadBaseDir = "./image/profile"
-	}
-	uploadDir := filepath.Join(uploadBaseDir, clientID)
+// UploadPhotoProfile handles the upload of a single photo profile. Once
+// scanned for malware, the photo is normalized into a square of at most the
+// configured size and becomes the current one; previous photos are kept in
+// the client's profile history.
+func (s *imageService) UploadPhotoProfile(file in.UploadFile, clientID string, options in.UploadOptions) (response.ImageResponse, error) {
+	uploadDir := s.StagingDir(clientID, imaging.ScopeProfile)
 
 	log.Info().Msgf("Uploading photo profile for client: %s", clientID)
 
-	// Ensure client directory exists (create if not)
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-			log.Error().Err(err).Msg("Failed to create directory")
-			return response.ImageResponse{}, err
-		}
-	} else {
-		// Delete all existing files in the folder
-		files, err := os.ReadDir(uploadDir)
-		if err != nil {
-			log.Error().Err(err).Msg("Failed to list existing files for deletion")
-			return response.ImageResponse{}, err
-		}
-		for _, f := range files {
-			err := os.Remove(filepath.Join(uploadDir, f.Name()))
-			if err != nil {
-				log.Error().Err(err).Msgf("Failed to delete old file: %s", f.Name())
-			}
-		}
+	if err := s.ScanService.Check(file, clientID); err != nil {
+		_ = os.Remove(file.Path)
+		return response.ImageResponse{}, err
 	}
 
-	// Open file
-	src, err := file.Open()
+	// The staged upload is always re-encoded, never moved into place
+	data, err := os.ReadFile(file.Path)
+	_ = os.Remove(file.Path)
 	if err != nil {
 		return response.ImageResponse{}, err
 	}
 
-	err = src.Close()
+	// Without a focal point the photo is cropped around its centre
+	hint := imaging.CropHint{NoSmart: true}
+	if options.FocalX != nil && options.FocalY != nil {
+		hint.Focal = &imaging.PointF{X: *options.FocalX, Y: *options.FocalY}
+	}
+	exif, err := imaging.ReadExif(data, imaging.DetectFormat(data))
+	if err != nil {
+		exif = &imaging.Exif{Orientation: 1, Fields: map[string]string{}}
+	}
+
+	normalized, err := imaging.Run(s.Pool, func() ([]byte, error) {
+		return imaging.NormalizeProfile(data, s.ProfileOptions, hint)
+	})
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to close file")
 		return response.ImageResponse{}, err
 	}
 
-	// Generate safe filename
-	newFileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), filepath.Ext(file.Filename))
-	filePath := filepath.Join(uploadDir, newFileName)
+	// Ensure client directory exists (create if not)
+	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
+		log.Error().Err(err).Msg("Failed to create directory")
+		return response.ImageResponse{}, err
+	}
 
-	// Create destination file
-	dst, err := os.Create(filePath)
-	if err != nil {
+	newFileName := newImageName(imaging.Extension(s.ProfileOptions.Format))
+	filePath := filepath.Join(uploadDir, newFileName)
+	if err := writeFile(filePath, normalized); err != nil {
 		return response.ImageResponse{}, err
 	}
+	log.Info().Msgf("Profile photo uploaded: %s (%d bytes, %d before normalization)", newFileName, len(normalized), len(data))
 
-	err = src.Close()
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to close file")
+	// Make it current; photos beyond the history size are deleted
+	uploadedAt := time.Now()
+	if err := s.ModerationService.Submit(clientID, newFileName, filePath, imaging.ContentType(s.ProfileOptions.Format)); err != nil {
+		_ = os.Remove(filePath)
+		return response.ImageResponse{}, err
+	}
+	if err := s.ProfileService.Record(clientID, newFileName, uploadedAt); err != nil {
+		_ = os.Remove(filePath)
+		s.ModerationService.Forget(clientID, newFileName)
 		return response.ImageResponse{}, err
 	}
 
-	// Copy file data
-	fileSize, err := io.Copy(dst, src)
+	if len(exif.Fields) > 0 {
+		err := s.ImageMetadataRepository.SaveExif(&metadata.ImageExif{
+			ClientID:    clientID,
+			Filename:    newFileName,
+			Orientation: exif.Orientation,
+			Fields:      exif.Fields,
+			Stripped:    true,
+			ExtractedAt: time.Now(),
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to store EXIF for %s", newFileName)
+		}
+	}
+
+	meta, err := imaging.Run(s.Pool, func() (*metadata.ImageMetadata, error) {
+		return buildMetadata(clientID, newFileName, imaging.ScopeProfile, normalized, uploadedAt), nil
+	})
 	if err != nil {
 		return response.ImageResponse{}, err
 	}
-	log.Info().Msgf("File uploaded: %s (%d bytes)", newFileName, fileSize)
-
-	imageResponse := response.ImageResponse{
-		ImageURL: fmt.Sprintf("/cdn/%s/%s", clientID, newFileName),
-		FileType: strings.TrimPrefix(filepath.Ext(file.Filename), "."),
-		FileSize: fileSize,
+	if err := s.ImageMetadataRepository.SaveMetadata(meta); err != nil {
+		log.Error().Err(err).Msgf("Failed to store metadata for %s", newFileName)
 	}
 
+	// The photo is already square, so presets need no crop hint
+	s.VariantService.Schedule(clientID, newFileName, filePath, imaging.ScopeProfile, RenderOptions{})
+
+	imageResponse := s.toImageResponse(*meta)
+	imageResponse.SHA256 = file.SHA256
+	s.WebhookService.Dispatch(clientID, webhook.EventImageUploaded, imageResponse)
+
 	return imageResponse, nil
 }
 
-func (s *imageService) UploadImages(files []*multipart.FileHeader, clientID string) ([]response.ImageResponse, error) {
-	var uploadedImages []response.ImageResponse
-
-	uploadBaseDir := s.UploadDir
-	if uploadBaseDir == "" {
-		uploadBaseDir = "./image/asset" // fallback default
-	}
-	uploadDir := filepath.Join(uploadBaseDir, clientID)
+func (s *imageService) UploadImages(files []in.UploadFile, clientID string, options in.UploadOptions) ([]response.UploadResult, error) {
+	uploadDir := s.StagingDir(clientID, imaging.ScopeAsset)
 
 	log.Info().Msgf("Uploading %d images for client: %s", len(files), clientID)
 	// Ensure client directory exists
@@ -131,87 +206,1040 @@ func (s *imageService) UploadImages(files []*multipart.FileHeader, clientID stri
 		}
 	}
 
-	// Process each file
-	for _, file := range files {
-		// Open file
-		src, err := file.Open()
-		if err != nil {
-			return nil, err
+	// Process the files on a bounded number of workers, recording each outcome
+	// at its index instead of giving up on the batch. Atomic batches only
+	// write the files here and publish them once every file was stored.
+	results := make([]response.UploadResult, len(files))
+	stored := make([]string, len(files))
+	pending := make([]*storedImage, len(files))
+	errs := make([]error, len(files))
+	slots := make(chan struct{}, s.UploadWorkers)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for i, file := range files {
+		results[i] = response.UploadResult{Index: i, Filename: file.Filename}
+
+		slots <- struct{}{}
+		if options.Atomic && failed.Load() {
+			<-slots
+			results[i].Status = response.UploadSkipped
+			continue
 		}
-		defer func(src multipart.File) {
-			err := src.Close()
+
+		wg.Add(1)
+		go func(i int, file in.UploadFile) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			var imageResponse response.ImageResponse
+			var filename string
+			var err error
+			if options.Atomic {
+				pending[i], imageResponse, err = s.storeImage(file, uploadDir, clientID, imaging.ScopeAsset, options)
+				if pending[i] != nil {
+					filename = pending[i].filename
+				}
+			} else {
+				imageResponse, filename, err = s.saveImage(file, uploadDir, clientID, imaging.ScopeAsset, options)
+			}
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to close file")
+				log.Error().Err(err).Msgf("Failed to upload %s", file.Filename)
+				failed.Store(true)
+				errs[i] = err
+				results[i].Status = response.UploadFailed
+				results[i].Error = uploadErrorCode(err)
+				results[i].Message = err.Error()
 				return
 			}
-		}(src)
 
-		// Generate safe filename
-		extension := strings.ToLower(filepath.Ext(file.Filename))
-		newFileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), extension)
-		filePath := filepath.Join(uploadDir, newFileName)
+			results[i].Status = response.UploadCreated
+			if filename == "" {
+				results[i].Image = &imageResponse
+				results[i].Status = response.UploadDuplicate
+			} else if !options.Atomic {
+				results[i].Image = &imageResponse
+			}
+			stored[i] = filename
+		}(i, file)
+	}
+	wg.Wait()
 
-		// Create destination file
-		dst, err := os.Create(filePath)
+	var failure error
+	for _, err := range errs {
 		if err != nil {
-			return nil, err
+			failure = err
+			break
 		}
-		defer func(dst *os.File) {
-			err := dst.Close()
+	}
+
+	// Every file of an atomic batch was stored: publish them
+	if failure == nil && options.Atomic {
+		for i, image := range pending {
+			if image == nil {
+				continue
+			}
+			imageResponse, err := s.publishImage(image)
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to close file")
-				return
+				log.Error().Err(err).Msgf("Failed to upload %s", files[i].Filename)
+				failure = err
+				stored[i] = ""
+				results[i].Status = response.UploadFailed
+				results[i].Error = uploadErrorCode(err)
+				results[i].Message = err.Error()
+				break
 			}
-		}(dst)
+			results[i].Image = &imageResponse
+		}
+	}
+
+	if failure != nil && options.Atomic {
+		for i, filename := range stored {
+			if filename == "" {
+				continue
+			}
+			s.discardImage(clientID, filename)
+			results[i].Image = nil
+			results[i].Status = response.UploadRolledBack
+		}
+		return results, fmt.Errorf("%w: %w", ErrBatchRolledBack, failure)
+	}
+
+	// Announce only what was kept
+	for i, filename := range stored {
+		if filename != "" {
+			s.WebhookService.Dispatch(clientID, webhook.EventImageUploaded, *results[i].Image)
+		}
+	}
+	return results, nil
+}
+
+// UploadImage stores a single staged asset, such as one imported from a URL,
+// through the same pipeline as batch uploads
+func (s *imageService) UploadImage(file in.UploadFile, clientID string, options in.UploadOptions) (response.ImageResponse, error) {
+	uploadDir := s.StagingDir(clientID, imaging.ScopeAsset)
+	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
+		log.Error().Err(err).Msg("Failed to create directory")
+		return response.ImageResponse{}, err
+	}
+
+	imageResponse, filename, err := s.saveImage(file, uploadDir, clientID, imaging.ScopeAsset, options)
+	if err != nil {
+		return response.ImageResponse{}, err
+	}
+	if filename != "" {
+		s.WebhookService.Dispatch(clientID, webhook.EventImageUploaded, imageResponse)
+	}
+	return imageResponse, nil
+}
+
+// discardImage removes a freshly stored image together with its records and
+// renditions, as if it had never been uploaded
+func (s *imageService) discardImage(clientID, filename string) {
+	if err := os.Remove(filepath.Join(s.StagingDir(clientID, imaging.ScopeAsset), filename)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msgf("Failed to roll back %s", filename)
+	}
+	if err := s.ImageMetadataRepository.DeleteExif(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete EXIF for %s", filename)
+	}
+	if err := s.ImageMetadataRepository.DeleteMetadata(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete metadata for %s", filename)
+	}
+	if err := s.VariantService.DeleteVariants(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete variants of %s", filename)
+	}
+	s.ModerationService.Forget(clientID, filename)
+}
+
+// uploadErrorCode maps an upload failure to the code reported for its file
+func uploadErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrDuplicateImage):
+		return "duplicate"
+	case errors.Is(err, ErrTypeNotAllowed):
+		return "type_not_allowed"
+	case errors.Is(err, ErrInfectedFile):
+		return "infected"
+	case errors.Is(err, ErrScannerUnavailable):
+		return "scanner_unavailable"
+	case errors.Is(err, imaging.ErrImageTooLarge):
+		return "image_too_large"
+	case errors.Is(err, imaging.ErrProcessingTimeout):
+		return "processing_timeout"
+	case errors.Is(err, imaging.ErrInvalidImage):
+		return "invalid_image"
+	}
+	return "internal_error"
+}
+
+// saveImage stores one staged upload and publishes it. The stored filename
+// is returned, or an empty one when the upload was linked to an existing image.
+func (s *imageService) saveImage(file in.UploadFile, dir, clientID, scope string, options in.UploadOptions) (response.ImageResponse, string, error) {
+	stored, linked, err := s.storeImage(file, dir, clientID, scope, options)
+	if err != nil || stored == nil {
+		return linked, "", err
+	}
+	imageResponse, err := s.publishImage(stored)
+	if err != nil {
+		return response.ImageResponse{}, "", err
+	}
+	return imageResponse, stored.filename, nil
+}
 
-		// Copy file data
-		fileSize, err := io.Copy(dst, src)
+// storedImage is an upload written to its final place but not yet published
+type storedImage struct {
+	clientID         string
+	filename         string
+	path             string
+	scope            string
+	contentType      string
+	sha256           string
+	preserveMetadata bool
+	exif             *imaging.Exif
+	meta             *metadata.ImageMetadata
+}
+
+// storeImage writes one staged upload to dir under a generated name. The
+// upload is scanned for malware first. Image metadata is extracted and,
+// unless the caller asked to preserve it, stripped and the pixels rotated
+// upright before anything is written. When asked to, near-duplicates of a
+// stored image are rejected or answered with that image, in which case no
+// stored image is returned. The staging file is moved into place when its
+// bytes are kept as they are and removed otherwise.
+func (s *imageService) storeImage(file in.UploadFile, dir, clientID, scope string, options in.UploadOptions) (*storedImage, response.ImageResponse, error) {
+	defer func() {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Msgf("Failed to remove staged upload %s", file.Path)
+		}
+	}()
+	if err := s.ScanService.Check(file, clientID); err != nil {
+		return nil, response.ImageResponse{}, err
+	}
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return nil, response.ImageResponse{}, err
+	}
+
+	// Generate safe filename, trusting the content over the client's extension
+	extension := strings.ToLower(filepath.Ext(file.Filename))
+	format := imaging.DetectFormat(data)
+	if format != "" {
+		extension = imaging.Extension(format)
+	} else if extension == ".svg" {
+		// Would be served as image/svg+xml without having been sanitized
+		return nil, response.ImageResponse{}, fmt.Errorf("%w: not a valid svg document", imaging.ErrInvalidImage)
+	}
+	if format == "" && options.ImagesOnly {
+		return nil, response.ImageResponse{}, fmt.Errorf("%w: not a supported image", ErrTypeNotAllowed)
+	}
+	if len(options.AllowedFormats) > 0 && !slices.Contains(options.AllowedFormats, format) {
+		return nil, response.ImageResponse{}, fmt.Errorf("%w: %s", ErrTypeNotAllowed, imaging.ContentType(format))
+	}
+	newFileName := newImageName(extension)
+	filePath := filepath.Join(dir, newFileName)
+
+	// Refuse decompression bombs from their headers, before decoding anything
+	if format != "" {
+		if _, err := imaging.CheckLimits(data); err != nil {
+			return nil, response.ImageResponse{}, err
+		}
+	}
+
+	type sanitizedImage struct {
+		result *imaging.SanitizeResult
+		meta   *metadata.ImageMetadata
+	}
+	processed, err := imaging.Run(s.Pool, func() (sanitizedImage, error) {
+		result, err := imaging.Sanitize(data, format, options.PreserveMetadata)
 		if err != nil {
-			return nil, err
+			return sanitizedImage{}, err
 		}
-		log.Info().Msgf("File uploaded: %s (%d bytes)", newFileName, fileSize)
+		return sanitizedImage{result: result, meta: buildMetadata(clientID, newFileName, scope, result.Data, time.Now())}, nil
+	})
+	if err != nil {
+		return nil, response.ImageResponse{}, err
+	}
+	sanitized, meta := processed.result, processed.meta
 
-		// Get file metadata
-		imageResponse := response.ImageResponse{
-			ImageURL:   fmt.Sprintf("/cdn/%s/%s", clientID, newFileName), // Serve via API
-			FileType:   strings.TrimPrefix(extension, "."),               // Remove dot (jpg, png)
-			FileSize:   fileSize,
-			UploadedAt: time.Now(),
+	if options.Duplicates != "" && meta.PHash != "" {
+		matches, err := s.duplicates(clientID, meta.PHash, "", s.DuplicateDistance)
+		if err != nil {
+			return nil, response.ImageResponse{}, err
 		}
+		if len(matches) > 0 {
+			existing := matches[0].meta
+			if options.Duplicates == in.DuplicatesReject {
+				return nil, response.ImageResponse{}, fmt.Errorf("%w: %s", ErrDuplicateImage, existing.Filename)
+			}
+			log.Info().Msgf("Upload %s matches %s, linking instead of storing", file.Filename, existing.Filename)
+			imageResponse := s.toImageResponse(existing)
+			imageResponse.Duplicate = true
+			imageResponse.SHA256 = file.SHA256
+			return nil, imageResponse, nil
+		}
+	}
 
-		// Append to response
-		uploadedImages = append(uploadedImages, imageResponse)
+	if err := commitFile(file.Path, filePath, data, sanitized.Data); err != nil {
+		return nil, response.ImageResponse{}, err
 	}
+	fileSize := int64(len(sanitized.Data))
+	log.Info().Msgf("File uploaded: %s (%d bytes)", newFileName, fileSize)
 
-	return uploadedImages, nil
+	return &storedImage{
+		clientID:         clientID,
+		filename:         newFileName,
+		path:             filePath,
+		scope:            scope,
+		contentType:      imaging.ContentType(format),
+		sha256:           file.SHA256,
+		preserveMetadata: options.PreserveMetadata,
+		exif:             sanitized.Exif,
+		meta:             meta,
+	}, response.ImageResponse{}, nil
 }
 
-func (s *imageService) GetImage(imageName, clientID string) (*string, error) {
-	// Check in UPLOAD_DIR
+// publishImage makes a stored upload known: it is submitted for moderation,
+// its records are saved and the presets of its scope are queued for
+// background generation. The file is removed when it cannot be submitted.
+func (s *imageService) publishImage(stored *storedImage) (response.ImageResponse, error) {
+	// Held back from the public until reviewed when moderation is enabled
+	if err := s.ModerationService.Submit(stored.clientID, stored.filename, stored.path, stored.contentType); err != nil {
+		_ = os.Remove(stored.path)
+		return response.ImageResponse{}, err
+	}
+
+	if len(stored.exif.Fields) > 0 || stored.exif.Orientation > 1 {
+		err := s.ImageMetadataRepository.SaveExif(&metadata.ImageExif{
+			ClientID:    stored.clientID,
+			Filename:    stored.filename,
+			Orientation: stored.exif.Orientation,
+			Fields:      stored.exif.Fields,
+			Stripped:    !stored.preserveMetadata,
+			ExtractedAt: time.Now(),
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to store EXIF for %s", stored.filename)
+		}
+	}
+
+	if err := s.ImageMetadataRepository.SaveMetadata(stored.meta); err != nil {
+		log.Error().Err(err).Msgf("Failed to store metadata for %s", stored.filename)
+	}
+
+	s.VariantService.Schedule(stored.clientID, stored.filename, stored.path, stored.scope, RenderOptions{Hint: cropHint(stored.meta), Animated: isAnimatedGIF(stored.meta)})
+
+	imageResponse := s.toImageResponse(*stored.meta)
+	imageResponse.SHA256 = stored.sha256
+	return imageResponse, nil
+}
+
+// buildMetadata computes the stored record of an image from its bytes. Files
+// that cannot be decoded still get a record with their size and checksum.
+func buildMetadata(clientID, filename, scope string, data []byte, uploadedAt time.Time) *metadata.ImageMetadata {
+	checksum := sha256.Sum256(data)
+	meta := &metadata.ImageMetadata{
+		ClientID:   clientID,
+		Filename:   filename,
+		Scope:      scope,
+		FileType:   strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), "."), // Remove dot (jpg, png)
+		FileSize:   int64(len(data)),
+		Checksum:   hex.EncodeToString(checksum[:]),
+		UploadedAt: uploadedAt,
+	}
+
+	format := imaging.DetectFormat(data)
+	if format == "" {
+		return meta
+	}
+	meta.Format = format
+
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to decode %s for metadata", filename)
+		return meta
+	}
+
+	// Colours, placeholders and hashes describe the image as renditions show
+	// it, converted to sRGB. The stored original keeps its profile.
+	if profile := imaging.EmbeddedProfile(data); profile != nil {
+		meta.ICCProfile = profile.Description
+		meta.NonSRGB = !profile.IsSRGB()
+		img = profile.ToSRGB(img)
+	}
+
+	if analysis, err := imaging.Analyze(data, format, img); err != nil {
+		log.Warn().Err(err).Msgf("Failed to analyze %s", filename)
+	} else {
+		meta.Width = analysis.Width
+		meta.Height = analysis.Height
+		meta.HasAlpha = analysis.HasAlpha
+		meta.Animated = analysis.Animated
+		meta.FrameCount = analysis.FrameCount
+		meta.DurationMs = analysis.Duration.Milliseconds()
+		meta.Colors = analysis.DominantColors
+	}
+
+	if placeholders, err := imaging.GeneratePlaceholders(img); err != nil {
+		log.Warn().Err(err).Msgf("Failed to generate placeholders for %s", filename)
+	} else {
+		meta.BlurHash = placeholders.BlurHash
+		meta.Placeholder = placeholders.LQIP
+	}
+
+	if hash, err := orientedHash(data, format, img); err != nil {
+		log.Warn().Err(err).Msgf("Failed to hash %s", filename)
+	} else {
+		meta.PHash = hash
+	}
+	return meta
+}
+
+// toImageResponse builds the API representation of a stored image
+func (s *imageService) toImageResponse(meta metadata.ImageMetadata) response.ImageResponse {
+	state, err := s.ModerationService.State(meta.ClientID, meta.Filename)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to read the moderation state of %s", meta.Filename)
+	}
+	return response.ImageResponse{
+		ImageURL:    fmt.Sprintf("/cdn/%s/%s", meta.ClientID, meta.Filename), // Serve via API
+		FileType:    meta.FileType,
+		FileSize:    meta.FileSize,
+		UploadedAt:  meta.UploadedAt,
+		Variants:    s.VariantService.VariantURLs(meta.ClientID, meta.Filename, meta.Scope, isAnimatedGIF(&meta)),
+		BlurHash:    meta.BlurHash,
+		Placeholder: meta.Placeholder,
+		Moderation:  state,
+	}
+}
+
+// lastImageName is the timestamp of the most recently generated filename
+var lastImageName atomic.Int64
+
+// newImageName returns a nanosecond timestamp filename that is unique within
+// the process, even for files of a batch stored at the same instant
+func newImageName(extension string) string {
+	for {
+		last := lastImageName.Load()
+		now := time.Now().UnixNano()
+		if now <= last {
+			now = last + 1
+		}
+		if lastImageName.CompareAndSwap(last, now) {
+			return fmt.Sprintf("%d%s", now, extension)
+		}
+	}
+}
+
+// StagingDir returns the directory uploads of a scope are staged in. It is
+// the client's storage directory, so unchanged files can be moved into place.
+func (s *imageService) StagingDir(clientID, scope string) string {
+	if scope == imaging.ScopeProfile {
+		uploadBaseDir := s.ProfileUploadDir
+		if uploadBaseDir == "" {
+			uploadBaseDir = "./image/profile"
+		}
+		return filepath.Join(uploadBaseDir, clientID)
+	}
 	uploadBaseDir := s.UploadDir
 	if uploadBaseDir == "" {
-		uploadBaseDir = "./uploads"
+		uploadBaseDir = "./image/asset" // fallback default
+	}
+	return filepath.Join(uploadBaseDir, clientID)
+}
+
+// commitFile stores the processed bytes of a staged upload at path. When
+// processing left them unchanged the staging file is renamed instead of
+// being written a second time.
+func commitFile(staged, path string, original, processed []byte) error {
+	if bytes.Equal(original, processed) {
+		if err := os.Rename(staged, path); err == nil {
+			return nil
+		}
 	}
-	filePath := filepath.Join(uploadBaseDir, clientID, imageName)
+	return writeFile(path, processed)
+}
+
+// writeFile creates path and writes data to it, removing the file on failure
+func writeFile(path string, data []byte) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := dst.Write(data); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+func (s *imageService) GetImage(imageName, clientID string) (*string, error) {
+	if !validPathSegment(imageName) || !validPathSegment(clientID) {
+		return nil, ErrImageNotFound
+	}
+
+	// Check in UPLOAD_DIR
+	filePath := filepath.Join(s.StagingDir(clientID, imaging.ScopeAsset), imageName)
 
-	if _, err := os.Stat(filePath); err == nil {
+	if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
 		return &filePath, nil
-	} else if !os.IsNotExist(err) {
+	} else if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 
 	// If not found, check in PROFILE_UPLOAD_DIR
-	profileUploadDir := s.ProfileUploadDir
-	if profileUploadDir == "" {
-		profileUploadDir = "./profile_uploads"
-	}
-	profilePath := filepath.Join(profileUploadDir, clientID, imageName)
+	profilePath := filepath.Join(s.StagingDir(clientID, imaging.ScopeProfile), imageName)
 
-	if _, err := os.Stat(profilePath); err == nil {
+	if info, err := os.Stat(profilePath); err == nil && !info.IsDir() {
 		return &profilePath, nil
-	} else if os.IsNotExist(err) {
-		return nil, errors.New("file not found")
+	} else if err == nil || os.IsNotExist(err) {
+		return nil, ErrImageNotFound
 	} else {
 		return nil, err
 	}
 }
+
+// validPathSegment rejects names that could escape the client directory and
+// hidden files such as staged uploads
+func validPathSegment(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
+
+// ListImages returns the stored images of a client, newest first
+func (s *imageService) ListImages(clientID string) ([]response.ImageResponse, error) {
+	records, err := s.ImageMetadataRepository.GetMetadataByClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]response.ImageResponse, 0, len(records))
+	for _, meta := range records {
+		images = append(images, s.toImageResponse(meta))
+	}
+	return images, nil
+}
+
+// GetOriginalImage returns the path of the full-size image to deliver. Public
+// requests get the client's watermark applied, when one is configured.
+func (s *imageService) GetOriginalImage(filename, clientID string, public bool) (*string, error) {
+	source, err := s.GetImage(filename, clientID)
+	if err != nil || !public {
+		return source, err
+	}
+	meta, err := s.getMetadata(clientID, filename)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s.renderOptions(clientID, meta, public)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := s.VariantService.GetOriginal(clientID, filename, *source, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &path, nil
+}
+
+// GetImageVariant returns the path of a preset rendition of an image
+func (s *imageService) GetImageVariant(filename, clientID, preset string, public bool) (*string, error) {
+	source, err := s.GetImage(filename, clientID)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.getMetadata(clientID, filename)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s.renderOptions(clientID, meta, public)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := s.VariantService.GetVariant(clientID, filename, *source, meta.Scope, preset, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &path, nil
+}
+
+// GetResizedImage returns the path of an ad-hoc rendition of an image
+func (s *imageService) GetResizedImage(filename, clientID string, request in.ResizeRequest, public bool) (*string, error) {
+	source, err := s.GetImage(filename, clientID)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.getMetadata(clientID, filename)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s.renderOptions(clientID, meta, public)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := s.VariantService.GetResized(clientID, filename, *source, request.Width, request.Height, request.Fit, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &path, nil
+}
+
+// renderOptions combines the stored framing of an image with the client's
+// watermark for public deliveries
+func (s *imageService) renderOptions(clientID string, meta *metadata.ImageMetadata, public bool) (RenderOptions, error) {
+	opts := RenderOptions{Hint: cropHint(meta), Animated: isAnimatedGIF(meta)}
+	if public {
+		wm, key, err := s.WatermarkService.Load(clientID)
+		if err != nil {
+			return RenderOptions{}, err
+		}
+		opts.Watermark = wm
+		opts.WatermarkKey = key
+	}
+	return opts, nil
+}
+
+// SetImageFocus stores the focal point and/or crop rectangle of an image and
+// drops its renditions so they are regenerated with the new framing.
+func (s *imageService) SetImageFocus(filename, clientID string, request in.FocusRequest) (response.ImageMetadataResponse, error) {
+	if (request.FocalX == nil) != (request.FocalY == nil) || (request.FocalX == nil && request.Crop == nil) {
+		return response.ImageMetadataResponse{}, fmt.Errorf("%w: provide focal_x and focal_y, a crop rectangle, or both", ErrInvalidFocus)
+	}
+
+	meta, err := s.getMetadata(clientID, filename)
+	if err != nil {
+		return response.ImageMetadataResponse{}, err
+	}
+
+	meta.FocalPoint = nil
+	if request.FocalX != nil {
+		if !isFraction(*request.FocalX) || !isFraction(*request.FocalY) {
+			return response.ImageMetadataResponse{}, fmt.Errorf("%w: focal point must be within 0 and 1", ErrInvalidFocus)
+		}
+		meta.FocalPoint = &metadata.FocalPoint{X: *request.FocalX, Y: *request.FocalY}
+	}
+
+	meta.CropRect = nil
+	if c := request.Crop; c != nil {
+		if !isFraction(c.X) || !isFraction(c.Y) || c.Width <= 0 || c.Height <= 0 || c.X+c.Width > 1 || c.Y+c.Height > 1 {
+			return response.ImageMetadataResponse{}, fmt.Errorf("%w: crop rectangle must lie within the image", ErrInvalidFocus)
+		}
+		meta.CropRect = &metadata.CropRect{X: c.X, Y: c.Y, Width: c.Width, Height: c.Height}
+	}
+
+	if err := s.ImageMetadataRepository.SaveMetadata(meta); err != nil {
+		return response.ImageMetadataResponse{}, err
+	}
+	if err := s.VariantService.DeleteVariants(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete stale variants of %s", filename)
+	}
+	return toMetadataResponse(meta), nil
+}
+
+// ClearImageFocus removes the focal point and crop rectangle of an image
+func (s *imageService) ClearImageFocus(filename, clientID string) error {
+	meta, err := s.getMetadata(clientID, filename)
+	if err != nil {
+		return err
+	}
+	meta.FocalPoint = nil
+	meta.CropRect = nil
+
+	if err := s.ImageMetadataRepository.SaveMetadata(meta); err != nil {
+		return err
+	}
+	if err := s.VariantService.DeleteVariants(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete stale variants of %s", filename)
+	}
+	return nil
+}
+
+// cropHint translates the stored framing of an image for the resizer
+func cropHint(meta *metadata.ImageMetadata) imaging.CropHint {
+	var hint imaging.CropHint
+	if meta.FocalPoint != nil {
+		hint.Focal = &imaging.PointF{X: meta.FocalPoint.X, Y: meta.FocalPoint.Y}
+	}
+	if meta.CropRect != nil {
+		hint.Rect = &imaging.RectF{X: meta.CropRect.X, Y: meta.CropRect.Y, Width: meta.CropRect.Width, Height: meta.CropRect.Height}
+	}
+	return hint
+}
+
+// isAnimatedGIF reports whether renditions of an image must keep its frames
+func isAnimatedGIF(meta *metadata.ImageMetadata) bool {
+	return meta.Animated && meta.Format == imaging.FormatGIF
+}
+
+func isFraction(v float64) bool {
+	return v >= 0 && v <= 1
+}
+
+// GetImageExif returns the EXIF fields captured when the image was uploaded
+func (s *imageService) GetImageExif(filename, clientID string) (response.ImageExifResponse, error) {
+	exif, err := s.ImageMetadataRepository.GetExif(clientID, filename)
+	if errors.Is(err, utils.ErrNoData) {
+		if _, err := s.GetImage(filename, clientID); err != nil {
+			return response.ImageExifResponse{}, err
+		}
+		// The image exists but carried no EXIF
+		return response.ImageExifResponse{Filename: filename, Orientation: 1, Fields: map[string]string{}}, nil
+	} else if err != nil {
+		return response.ImageExifResponse{}, err
+	}
+
+	return response.ImageExifResponse{
+		Filename:    exif.Filename,
+		Orientation: exif.Orientation,
+		Stripped:    exif.Stripped,
+		Fields:      exif.Fields,
+		ExtractedAt: exif.ExtractedAt,
+	}, nil
+}
+
+// GetImageMetadata returns the stored metadata of an image. Images uploaded
+// before metadata was recorded are analyzed on first request. EXIF fields are
+// only included for the owner.
+func (s *imageService) GetImageMetadata(filename, clientID string, owner bool) (response.ImageMetadataResponse, error) {
+	meta, err := s.getMetadata(clientID, filename)
+	if err != nil {
+		return response.ImageMetadataResponse{}, err
+	}
+
+	resp := toMetadataResponse(meta)
+	if owner {
+		exif, err := s.ImageMetadataRepository.GetExif(clientID, filename)
+		if err == nil {
+			resp.Exif = exif.Fields
+		} else if !errors.Is(err, utils.ErrNoData) {
+			return response.ImageMetadataResponse{}, err
+		}
+	}
+	return resp, nil
+}
+
+// getMetadata loads the metadata record of an image, computing it first for
+// files stored before metadata was tracked.
+func (s *imageService) getMetadata(clientID, filename string) (*metadata.ImageMetadata, error) {
+	meta, err := s.ImageMetadataRepository.GetMetadata(clientID, filename)
+	if errors.Is(err, utils.ErrNoData) {
+		return s.backfillImage(clientID, filename)
+	}
+	return meta, err
+}
+
+func toMetadataResponse(meta *metadata.ImageMetadata) response.ImageMetadataResponse {
+	resp := response.ImageMetadataResponse{
+		ImageURL:       fmt.Sprintf("/cdn/%s/%s", meta.ClientID, meta.Filename),
+		Format:         meta.Format,
+		Width:          meta.Width,
+		Height:         meta.Height,
+		FileSize:       meta.FileSize,
+		Checksum:       meta.Checksum,
+		DominantColors: meta.Colors,
+		HasAlpha:       meta.HasAlpha,
+		Animated:       meta.Animated,
+		FrameCount:     meta.FrameCount,
+		DurationMs:     meta.DurationMs,
+		BlurHash:       meta.BlurHash,
+		Placeholder:    meta.Placeholder,
+		PHash:          meta.PHash,
+		ICCProfile:     meta.ICCProfile,
+		NonSRGB:        meta.NonSRGB,
+		UploadedAt:     meta.UploadedAt,
+	}
+	if meta.FocalPoint != nil {
+		resp.FocalPoint = &response.FocusPoint{X: meta.FocalPoint.X, Y: meta.FocalPoint.Y}
+	}
+	if meta.CropRect != nil {
+		resp.CropRect = &response.FocusRect{X: meta.CropRect.X, Y: meta.CropRect.Y, Width: meta.CropRect.Width, Height: meta.CropRect.Height}
+	}
+	return resp
+}
+
+// BackfillMetadata records metadata for every stored file that has none yet,
+// such as images uploaded before metadata was tracked.
+func (s *imageService) BackfillMetadata() (response.BackfillResponse, error) {
+	var result response.BackfillResponse
+
+	for _, dir := range []string{s.UploadDir, s.ProfileUploadDir} {
+		clients, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		for _, client := range clients {
+			if !client.IsDir() || s.isStorageRoot(filepath.Join(dir, client.Name())) {
+				continue
+			}
+			files, err := os.ReadDir(filepath.Join(dir, client.Name()))
+			if err != nil {
+				return result, err
+			}
+
+			for _, f := range files {
+				if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+					continue
+				}
+				result.Scanned++
+
+				meta, err := s.ImageMetadataRepository.GetMetadata(client.Name(), f.Name())
+				if err == nil {
+					// Records from before perceptual hashing only lack the hash
+					if meta.PHash == "" && meta.Format != "" {
+						if err := s.hashImage(meta); err != nil {
+							log.Warn().Err(err).Msgf("Failed to hash %s/%s", client.Name(), f.Name())
+						}
+					}
+					continue
+				}
+				if errors.Is(err, utils.ErrNoData) {
+					_, err = s.backfillImage(client.Name(), f.Name())
+				}
+				if err != nil {
+					log.Error().Err(err).Msgf("Failed to backfill metadata for %s/%s", client.Name(), f.Name())
+					result.Failed++
+					continue
+				}
+				result.Created++
+			}
+		}
+	}
+
+	log.Info().Msgf("Metadata backfill: %d scanned, %d created, %d failed", result.Scanned, result.Created, result.Failed)
+	return result, nil
+}
+
+// backfillImage computes and stores the metadata of an existing file
+func (s *imageService) backfillImage(clientID, filename string) (*metadata.ImageMetadata, error) {
+	path, err := s.GetImage(filename, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(*path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := imaging.ScopeAsset
+	if s.ProfileUploadDir != "" && strings.HasPrefix(*path, filepath.Clean(s.ProfileUploadDir)+string(os.PathSeparator)) {
+		scope = imaging.ScopeProfile
+	}
+
+	meta, err := imaging.Run(s.Pool, func() (*metadata.ImageMetadata, error) {
+		return buildMetadata(clientID, filename, scope, data, info.ModTime()), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ImageMetadataRepository.SaveMetadata(meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// isStorageRoot reports whether dir is one of the configured storage roots,
+// which may be nested inside the upload directory.
+func (s *imageService) isStorageRoot(dir string) bool {
+	dir = filepath.Clean(dir)
+	return dir == filepath.Clean(s.ProfileUploadDir) || dir == filepath.Clean(s.UploadDir)
+}
+
+// FindDuplicates returns the client's images whose perceptual hash is within
+// the requested distance of a stored image, closest first
+func (s *imageService) FindDuplicates(filename, clientID string, request in.DuplicateRequest) ([]response.DuplicateResponse, error) {
+	distance, err := s.duplicateDistance(request)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.getMetadata(clientID, filename)
+	if err != nil {
+		return nil, err
+	}
+	if meta.PHash == "" {
+		if err := s.hashImage(meta); err != nil {
+			return nil, err
+		}
+	}
+
+	matches, err := s.duplicates(clientID, meta.PHash, filename, distance)
+	if err != nil {
+		return nil, err
+	}
+	return toDuplicateResponses(matches), nil
+}
+
+// FindDuplicatesOf hashes an uploaded file without storing it and returns
+// the client's images within the requested distance, closest first
+func (s *imageService) FindDuplicatesOf(file in.UploadFile, clientID string, request in.DuplicateRequest) ([]response.DuplicateResponse, error) {
+	distance, err := s.duplicateDistance(request)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := s.perceptualHash(data)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := s.duplicates(clientID, hash, "", distance)
+	if err != nil {
+		return nil, err
+	}
+	return toDuplicateResponses(matches), nil
+}
+
+// hashImage adds the perceptual hash to a record stored before hashes were
+// computed
+func (s *imageService) hashImage(meta *metadata.ImageMetadata) error {
+	path, err := s.GetImage(meta.Filename, meta.ClientID)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		return err
+	}
+	if meta.PHash, err = s.perceptualHash(data); err != nil {
+		return err
+	}
+	return s.ImageMetadataRepository.SaveMetadata(meta)
+}
+
+// perceptualHash decodes and hashes an image in a pool slot
+func (s *imageService) perceptualHash(data []byte) (string, error) {
+	return imaging.Run(s.Pool, func() (string, error) {
+		img, _, err := imaging.Decode(data)
+		if err != nil {
+			return "", err
+		}
+		// Hash the sRGB pixels, like buildMetadata does
+		return orientedHash(data, imaging.DetectFormat(data), imaging.NormalizeColor(data, img))
+	})
+}
+
+// orientedHash hashes a decoded sRGB image upright, so an upload still
+// carrying its EXIF orientation matches the rotated copy saveImage stores
+func orientedHash(data []byte, format string, img image.Image) (string, error) {
+	if exif, err := imaging.ReadExif(data, format); err == nil {
+		img = imaging.ApplyOrientation(img, exif.Orientation)
+	}
+	return imaging.PerceptualHash(img)
+}
+
+type duplicateMatch struct {
+	meta     metadata.ImageMetadata
+	distance int
+}
+
+// duplicates scans the client's images for hashes within distance of hash,
+// skipping the image named exclude
+func (s *imageService) duplicates(clientID, hash, exclude string, distance int) ([]duplicateMatch, error) {
+	records, err := s.ImageMetadataRepository.GetMetadataByClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []duplicateMatch
+	for _, meta := range records {
+		if meta.Filename == exclude || meta.PHash == "" {
+			continue
+		}
+		if d := imaging.HammingDistance(hash, meta.PHash); d >= 0 && d <= distance {
+			matches = append(matches, duplicateMatch{meta: meta, distance: d})
+		}
+	}
+
+	// Records come newest first; a stable sort keeps that order between ties
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+	return matches, nil
+}
+
+func (s *imageService) duplicateDistance(request in.DuplicateRequest) (int, error) {
+	if request.Distance == nil {
+		return s.DuplicateDistance, nil
+	}
+	if *request.Distance < 0 || *request.Distance > 64 {
+		return 0, fmt.Errorf("%w: distance must be between 0 and 64", ErrInvalidDistance)
+	}
+	return *request.Distance, nil
+}
+
+func toDuplicateResponses(matches []duplicateMatch) []response.DuplicateResponse {
+	duplicates := make([]response.DuplicateResponse, 0, len(matches))
+	for _, m := range matches {
+		duplicates = append(duplicates, response.DuplicateResponse{
+			ImageURL:   fmt.Sprintf("/cdn/%s/%s", m.meta.ClientID, m.meta.Filename),
+			Distance:   m.distance,
+			UploadedAt: m.meta.UploadedAt,
+		})
+	}
+	return duplicates
+}
+
+// DeleteImages removes files from storage and announces each deletion
+func (s *imageService) DeleteImages(clientID string, images []string) ([]string, []string) {
+	var deleted []string
+	var failed []string
+
+	for _, img := range images {
+		if !validPathSegment(img) || !validPathSegment(clientID) {
+			failed = append(failed, img)
+			continue
+		}
+		filePath := filepath.Join(s.StagingDir(clientID, imaging.ScopeAsset), img)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			log.Warn().Msgf("File not found: %s", filePath)
+			failed = append(failed, img)
+			continue
+		}
+
+		err := os.Remove(filePath)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to delete: %s", filePath)
+			failed = append(failed, img)
+		} else {
+			log.Info().Msgf("Deleted: %s", filePath)
+			deleted = append(deleted, img)
+			if err := s.ImageMetadataRepository.DeleteExif(clientID, img); err != nil {
+				log.Error().Err(err).Msgf("Failed to delete EXIF for %s", img)
+			}
+			if err := s.ImageMetadataRepository.DeleteMetadata(clientID, img); err != nil {
+				log.Error().Err(err).Msgf("Failed to delete metadata for %s", img)
+			}
+			if err := s.VariantService.DeleteVariants(clientID, img); err != nil {
+				log.Error().Err(err).Msgf("Failed to delete variants of %s", img)
+			}
+			s.ModerationService.Forget(clientID, img)
+			s.WebhookService.Dispatch(clientID, webhook.EventImageDeleted, imageDeletedPayload(clientID, img))
+		}
+	}
+
+	return deleted, failed
+}
+
+// imageDeletedPayload is the data of an image.deleted event
+func imageDeletedPayload(clientID, filename string) map[string]string {
+	return map[string]string{
+		"image_url": fmt.Sprintf("/cdn/%s/%s", clientID, filename),
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"cdn-service/internal/dto/in"
+	"cdn-service/internal/imaging"
+	"cdn-service/internal/scanner"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveImageScopedRejectsNonImages(t *testing.T) {
+	scanService, err := NewScanService(scanner.Noop{}, false, InfectedReject, "")
+	if err != nil {
+		t.Fatalf("NewScanService: %v", err)
+	}
+	s := &imageService{ScanService: scanService}
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		options in.UploadOptions
+	}{
+		{name: "text, any type", file: "notes.txt", content: []byte("just some text\n"), options: in.UploadOptions{ImagesOnly: true}},
+		{name: "binary, any type", file: "tool.exe", content: []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00"), options: in.UploadOptions{ImagesOnly: true}},
+		{name: "text named as an image", file: "photo.png", content: []byte("not a png"), options: in.UploadOptions{ImagesOnly: true}},
+		{name: "text, png only", file: "notes.txt", content: []byte("just some text\n"), options: in.UploadOptions{ImagesOnly: true, AllowedFormats: []string{imaging.FormatPNG}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(t.TempDir(), "upload.part")
+			if err := os.WriteFile(path, tt.content, 0o600); err != nil {
+				t.Fatalf("write upload: %v", err)
+			}
+			file := in.UploadFile{Path: path, Filename: tt.file, Size: int64(len(tt.content))}
+
+			_, filename, err := s.saveImage(file, dir, "client", "", tt.options)
+			if !errors.Is(err, ErrTypeNotAllowed) {
+				t.Fatalf("saveImage error = %v, want %v", err, ErrTypeNotAllowed)
+			}
+			if filename != "" {
+				t.Errorf("stored %s", filename)
+			}
+			if entries, err := os.ReadDir(dir); err != nil {
+				t.Fatalf("read upload dir: %v", err)
+			} else if len(entries) != 0 {
+				t.Errorf("%d files stored", len(entries))
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("staged upload left behind: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	response "cdn-service/internal/dto/out"
+	"cdn-service/internal/moderation"
+	"cdn-service/internal/repository"
+	"cdn-service/internal/utils"
+	"cdn-service/models/metadata"
+	"cdn-service/models/webhook"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+const reviewerClassifier = "classifier"
+
+var (
+	ErrModerationNotFound     = errors.New("moderated image not found")
+	ErrInvalidModerationState = errors.New("invalid moderation state")
+)
+
+// ModerationService holds uploaded images back from the public until a
+// moderator approved them. Every stored image moves through pending,
+// approved and rejected; images stored before moderation was enabled count
+// as approved.
+type ModerationService interface {
+	// Enabled reports whether uploads are moderated at all
+	Enabled() bool
+	// Submit records a freshly stored image as pending and hands it to the
+	// moderator in the background. It does nothing when moderation is off.
+	Submit(clientID, filename, path, contentType string) error
+	// State returns the review state of an image, or an empty one when
+	// moderation is off
+	State(clientID, filename string) (string, error)
+	List(state string, limit int) ([]response.ModerationResponse, error)
+	Approve(clientID, filename, reviewer string) (response.ModerationResponse, error)
+	Reject(clientID, filename, reviewer, reason string) (response.ModerationResponse, error)
+	// Forget drops the record of a deleted image
+	Forget(clientID, filename string)
+}
+
+type moderationService struct {
+	ModerationRepository    repository.ModerationRepository
+	ImageMetadataRepository repository.ImageMetadataRepository
+	WebhookService          WebhookService
+	Moderator               moderation.Moderator // Nil disables moderation
+	Timeout                 time.Duration
+	slots                   chan struct{}
+	mu                      sync.Mutex // Serializes state transitions
+}
+
+// NewModerationService initializes the service. At most workers images are
+// reviewed by the moderator at once.
+func NewModerationService(moderationRepository repository.ModerationRepository, imageMetadataRepository repository.ImageMetadataRepository, webhookService WebhookService, moderator moderation.Moderator, timeout time.Duration, workers int) ModerationService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &moderationService{
+		ModerationRepository:    moderationRepository,
+		ImageMetadataRepository: imageMetadataRepository,
+		WebhookService:          webhookService,
+		Moderator:               moderator,
+		Timeout:                 timeout,
+		slots:                   make(chan struct{}, workers),
+	}
+}
+
+func (s *moderationService) Enabled() bool {
+	return s.Moderator != nil
+}
+
+func (s *moderationService) Submit(clientID, filename, path, contentType string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	now := time.Now()
+	err := s.ModerationRepository.SaveModeration(&metadata.Moderation{
+		ClientID:  clientID,
+		Filename:  filename,
+		State:     metadata.ModerationPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	go s.review(moderation.Request{ClientID: clientID, Filename: filename, Path: path, ContentType: contentType})
+	return nil
+}
+
+// review asks the moderator for a verdict. Images it cannot decide on, or
+// fails to review, stay pending for an admin.
+func (s *moderationService) review(request moderation.Request) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	verdict, err := s.Moderator.Review(ctx, request)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Moderation of %s failed, leaving it for manual review", request.Filename)
+		return
+	}
+
+	state := metadata.ModerationPending
+	switch verdict.Decision {
+	case moderation.DecisionApprove:
+		state = metadata.ModerationApproved
+	case moderation.DecisionReject:
+		state = metadata.ModerationRejected
+	case moderation.DecisionReview:
+		if len(verdict.Labels) == 0 && verdict.Reason == "" {
+			return
+		}
+	}
+	if _, err := s.transition(request.ClientID, request.Filename, state, reviewerClassifier, verdict.Reason, verdict.Labels, false); err != nil && !errors.Is(err, ErrModerationNotFound) {
+		log.Error().Err(err).Msgf("Failed to record the moderation of %s", request.Filename)
+	}
+}
+
+func (s *moderationService) State(clientID, filename string) (string, error) {
+	if !s.Enabled() {
+		return "", nil
+	}
+	item, err := s.ModerationRepository.GetModeration(clientID, filename)
+	if errors.Is(err, utils.ErrNoData) {
+		return metadata.ModerationApproved, nil
+	} else if err != nil {
+		return "", err
+	}
+	return item.State, nil
+}
+
+// List returns images in a state, the longest waiting first
+func (s *moderationService) List(state string, limit int) ([]response.ModerationResponse, error) {
+	if !validModerationState(state) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidModerationState, state)
+	}
+	items, err := s.ModerationRepository.ListModeration(state, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]response.ModerationResponse, 0, len(items))
+	for _, item := range items {
+		responses = append(responses, toModerationResponse(item))
+	}
+	return responses, nil
+}
+
+func (s *moderationService) Approve(clientID, filename, reviewer string) (response.ModerationResponse, error) {
+	return s.transition(clientID, filename, metadata.ModerationApproved, reviewer, "", nil, true)
+}
+
+func (s *moderationService) Reject(clientID, filename, reviewer, reason string) (response.ModerationResponse, error) {
+	return s.transition(clientID, filename, metadata.ModerationRejected, reviewer, reason, nil, true)
+}
+
+func (s *moderationService) Forget(clientID, filename string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ModerationRepository.DeleteModeration(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete the moderation record of %s", filename)
+	}
+}
+
+// transition moves an image to a state and announces the change. Admins may
+// also decide on stored images without a record, such as ones uploaded
+// before moderation was enabled; the classifier only updates records that
+// still exist, so images deleted while under review stay deleted.
+func (s *moderationService) transition(clientID, filename, state, reviewer, reason string, labels map[string]float64, create bool) (response.ModerationResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.ModerationRepository.GetModeration(clientID, filename)
+	if errors.Is(err, utils.ErrNoData) {
+		if !create {
+			return response.ModerationResponse{}, ErrModerationNotFound
+		}
+		meta, err := s.ImageMetadataRepository.GetMetadata(clientID, filename)
+		if errors.Is(err, utils.ErrNoData) {
+			return response.ModerationResponse{}, ErrModerationNotFound
+		} else if err != nil {
+			return response.ModerationResponse{}, err
+		}
+		item = &metadata.Moderation{ClientID: clientID, Filename: filename, State: metadata.ModerationApproved, CreatedAt: meta.UploadedAt}
+	} else if err != nil {
+		return response.ModerationResponse{}, err
+	}
+
+	previous := item.State
+	item.State = state
+	item.Reason = reason
+	item.ReviewedBy = reviewer
+	if labels != nil {
+		item.Labels = labels
+	}
+	item.UpdatedAt = time.Now()
+	if err := s.ModerationRepository.SaveModeration(item); err != nil {
+		return response.ModerationResponse{}, err
+	}
+	log.Info().Msgf("Image %s of client %s is %s (was %s, by %s)", filename, clientID, state, previous, reviewer)
+
+	moderationResponse := toModerationResponse(*item)
+	if previous != state {
+		event := moderationResponse
+		event.PreviousState = previous
+		s.WebhookService.Dispatch(clientID, webhook.EventImageModerated, event)
+	}
+	return moderationResponse, nil
+}
+
+func validModerationState(state string) bool {
+	switch state {
+	case metadata.ModerationPending, metadata.ModerationApproved, metadata.ModerationRejected:
+		return true
+	}
+	return false
+}
+
+func toModerationResponse(item metadata.Moderation) response.ModerationResponse {
+	return response.ModerationResponse{
+		ClientID:   item.ClientID,
+		Filename:   item.Filename,
+		ImageURL:   fmt.Sprintf("/cdn/%s/%s", item.ClientID, item.Filename),
+		State:      item.State,
+		Reason:     item.Reason,
+		Labels:     item.Labels,
+		ReviewedBy: item.ReviewedBy,
+		CreatedAt:  item.CreatedAt,
+		UpdatedAt:  item.UpdatedAt,
+	}
+}
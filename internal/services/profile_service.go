@@ -0,0 +1,252 @@
+package services
+
+import (
+	response "cdn-service/internal/dto/out"
+	"cdn-service/internal/imaging"
+	"cdn-service/internal/repository"
+	"cdn-service/internal/utils"
+	"cdn-service/models/profile"
+	"cdn-service/models/webhook"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoProfilePhoto = errors.New("no profile photo")
+
+// ProfileService keeps the last few profile photos of each client and tracks
+// which one is current
+type ProfileService interface {
+	Record(clientID, filename string, uploadedAt time.Time) error
+	Current(clientID string) (string, time.Time, error)
+	ListHistory(clientID string) (response.ProfileHistoryResponse, error)
+	Restore(clientID, filename string) (response.ProfileHistoryResponse, error)
+	PurgeHistory(clientID string) ([]string, error)
+}
+
+type profileService struct {
+	ProfileRepository       repository.ProfileRepository
+	ImageMetadataRepository repository.ImageMetadataRepository
+	VariantService          VariantService
+	ModerationService       ModerationService
+	WebhookService          WebhookService
+	ProfileUploadDir        string
+	HistorySize             int
+
+	mu sync.Mutex
+}
+
+// NewProfileService initializes the service. historySize counts the current
+// photo, so 1 keeps no history at all.
+func NewProfileService(profileRepository repository.ProfileRepository, imageMetadataRepository repository.ImageMetadataRepository, variantService VariantService, moderationService ModerationService, webhookService WebhookService, profileUploadDir string, historySize int) ProfileService {
+	if historySize < 1 {
+		historySize = 1
+	}
+	return &profileService{
+		ProfileRepository:       profileRepository,
+		ImageMetadataRepository: imageMetadataRepository,
+		VariantService:          variantService,
+		ModerationService:       moderationService,
+		WebhookService:          webhookService,
+		ProfileUploadDir:        profileUploadDir,
+		HistorySize:             historySize,
+	}
+}
+
+// Record makes a freshly stored photo the current one and permanently
+// removes the photos that fall out of the history
+func (s *profileService) Record(clientID, filename string, uploadedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history, err := s.load(clientID)
+	if err != nil {
+		return err
+	}
+	// A history built from the directory already lists the new file
+	photos := []profile.Photo{{Filename: filename, UploadedAt: uploadedAt}}
+	for _, photo := range history.Photos {
+		if photo.Filename != filename {
+			photos = append(photos, photo)
+		}
+	}
+	history.Photos = photos
+
+	var evicted []profile.Photo
+	if len(history.Photos) > s.HistorySize {
+		evicted = history.Photos[s.HistorySize:]
+		history.Photos = history.Photos[:s.HistorySize]
+	}
+	if err := s.save(history); err != nil {
+		return err
+	}
+
+	for _, photo := range evicted {
+		s.remove(clientID, photo.Filename)
+	}
+	return nil
+}
+
+// Current returns the filename of the client's current profile photo and
+// when it last changed
+func (s *profileService) Current(clientID string) (string, time.Time, error) {
+	history, err := s.load(clientID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if len(history.Photos) == 0 {
+		return "", time.Time{}, ErrNoProfilePhoto
+	}
+	return history.Photos[0].Filename, history.UpdatedAt, nil
+}
+
+// ListHistory returns the retained photos, newest first
+func (s *profileService) ListHistory(clientID string) (response.ProfileHistoryResponse, error) {
+	history, err := s.load(clientID)
+	if err != nil {
+		return response.ProfileHistoryResponse{}, err
+	}
+	return s.toHistoryResponse(history), nil
+}
+
+// Restore makes a retained photo current again. It moves to the front of the
+// history as if it had just been uploaded.
+func (s *profileService) Restore(clientID, filename string) (response.ProfileHistoryResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history, err := s.load(clientID)
+	if err != nil {
+		return response.ProfileHistoryResponse{}, err
+	}
+
+	index := -1
+	for i, photo := range history.Photos {
+		if photo.Filename == filename {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return response.ProfileHistoryResponse{}, ErrImageNotFound
+	}
+
+	photo := history.Photos[index]
+	history.Photos = append(history.Photos[:index], history.Photos[index+1:]...)
+	history.Photos = append([]profile.Photo{photo}, history.Photos...)
+	if err := s.save(history); err != nil {
+		return response.ProfileHistoryResponse{}, err
+	}
+
+	log.Info().Msgf("Restored profile photo %s for client %s", filename, clientID)
+	return s.toHistoryResponse(history), nil
+}
+
+// PurgeHistory permanently deletes every photo but the current one and
+// returns the deleted filenames
+func (s *profileService) PurgeHistory(clientID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history, err := s.load(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history.Photos) <= 1 {
+		return []string{}, nil
+	}
+
+	purged := history.Photos[1:]
+	history.Photos = history.Photos[:1]
+	if err := s.save(history); err != nil {
+		return nil, err
+	}
+
+	deleted := make([]string, 0, len(purged))
+	for _, photo := range purged {
+		s.remove(clientID, photo.Filename)
+		deleted = append(deleted, photo.Filename)
+	}
+	return deleted, nil
+}
+
+// load reads the history of a client. Clients whose photos predate the
+// history get one built from the files in their profile directory.
+func (s *profileService) load(clientID string) (*profile.History, error) {
+	history, err := s.ProfileRepository.GetHistory(clientID)
+	if err == nil {
+		return history, nil
+	} else if !errors.Is(err, utils.ErrNoData) {
+		return nil, err
+	}
+
+	history = &profile.History{ClientID: clientID}
+	entries, err := os.ReadDir(filepath.Join(s.ProfileUploadDir, clientID))
+	if os.IsNotExist(err) {
+		return history, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		history.Photos = append(history.Photos, profile.Photo{Filename: entry.Name(), UploadedAt: info.ModTime()})
+	}
+	sort.SliceStable(history.Photos, func(i, j int) bool {
+		return history.Photos[i].UploadedAt.After(history.Photos[j].UploadedAt)
+	})
+	return history, nil
+}
+
+func (s *profileService) save(history *profile.History) error {
+	history.UpdatedAt = time.Now()
+	return s.ProfileRepository.SaveHistory(history)
+}
+
+// remove deletes a photo together with its renditions and records and
+// announces the deletion
+func (s *profileService) remove(clientID, filename string) {
+	if err := os.Remove(filepath.Join(s.ProfileUploadDir, clientID, filename)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msgf("Failed to delete old profile photo: %s", filename)
+	}
+	if err := s.VariantService.DeleteVariants(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete variants of old profile photo: %s", filename)
+	}
+	if err := s.ImageMetadataRepository.DeleteMetadata(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete metadata of old profile photo: %s", filename)
+	}
+	if err := s.ImageMetadataRepository.DeleteExif(clientID, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete EXIF of old profile photo: %s", filename)
+	}
+	s.ModerationService.Forget(clientID, filename)
+	s.WebhookService.Dispatch(clientID, webhook.EventImageDeleted, imageDeletedPayload(clientID, filename))
+}
+
+func (s *profileService) toHistoryResponse(history *profile.History) response.ProfileHistoryResponse {
+	photos := make([]response.ProfilePhotoResponse, 0, len(history.Photos))
+	for i, photo := range history.Photos {
+		photos = append(photos, response.ProfilePhotoResponse{
+			ImageURL:   fmt.Sprintf("/cdn/%s/%s", history.ClientID, photo.Filename),
+			Variants:   s.VariantService.VariantURLs(history.ClientID, photo.Filename, imaging.ScopeProfile, false),
+			UploadedAt: photo.UploadedAt,
+			Current:    i == 0,
+		})
+	}
+	return response.ProfileHistoryResponse{
+		CurrentURL: CurrentProfileURL(history.ClientID),
+		Photos:     photos,
+	}
+}
+
+// CurrentProfileURL is the stable URL of a client's current profile photo
+func CurrentProfileURL(clientID string) string {
+	return fmt.Sprintf("/profile/%s/current", clientID)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"cdn-service/internal/dto/in"
+	"cdn-service/internal/scanner"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	InfectedReject     = "reject"     // Infected uploads are deleted
+	InfectedQuarantine = "quarantine" // Infected uploads are kept aside for inspection
+)
+
+var (
+	ErrInfectedFile        = errors.New("file is infected")
+	ErrScannerUnavailable  = errors.New("upload could not be scanned")
+	ErrInvalidScanSettings = errors.New("invalid scan settings")
+)
+
+// ScanService checks staged uploads for malware before they are processed
+type ScanService interface {
+	// Check scans a staged upload. Infected files are refused with
+	// ErrInfectedFile, after being moved to the quarantine when configured.
+	// When the scanner fails the upload is refused with
+	// ErrScannerUnavailable, or let through when failing open.
+	Check(file in.UploadFile, clientID string) error
+}
+
+type scanService struct {
+	Scanner       scanner.Scanner
+	FailOpen      bool
+	QuarantineDir string // Empty to delete infected uploads
+}
+
+// quarantineRecord describes a quarantined upload, next to its content
+type quarantineRecord struct {
+	ClientID      string    `json:"client_id"`
+	Filename      string    `json:"filename"`
+	SHA256        string    `json:"sha256"`
+	Signature     string    `json:"signature"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// NewScanService initializes the service. action is InfectedReject or
+// InfectedQuarantine; quarantineDir is only used by the latter.
+func NewScanService(fileScanner scanner.Scanner, failOpen bool, action, quarantineDir string) (ScanService, error) {
+	s := scanService{Scanner: fileScanner, FailOpen: failOpen}
+	switch action {
+	case InfectedReject:
+	case InfectedQuarantine:
+		if quarantineDir == "" {
+			return nil, fmt.Errorf("%w: quarantine needs a directory", ErrInvalidScanSettings)
+		}
+		s.QuarantineDir = quarantineDir
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q, expected %s or %s", ErrInvalidScanSettings, action, InfectedReject, InfectedQuarantine)
+	}
+	return s, nil
+}
+
+func (s scanService) Check(file in.UploadFile, clientID string) error {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	result, err := s.Scanner.Scan(context.Background(), f)
+	_ = f.Close()
+	if err != nil {
+		if s.FailOpen {
+			log.Warn().Err(err).Msgf("Accepting unscanned upload %s of client %s", file.Filename, clientID)
+			return nil
+		}
+		log.Error().Err(err).Msgf("Refusing unscanned upload %s of client %s", file.Filename, clientID)
+		return fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+	}
+	if !result.Infected {
+		return nil
+	}
+
+	log.Warn().Msgf("Upload %s of client %s is infected with %s", file.Filename, clientID, result.Signature)
+	if s.QuarantineDir != "" {
+		if err := s.quarantine(file, clientID, result.Signature); err != nil {
+			log.Error().Err(err).Msgf("Failed to quarantine %s", file.Filename)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInfectedFile, result.Signature)
+}
+
+// quarantine moves the staged upload into the client's quarantine directory
+// with a JSON record of what was found. The names carry no extension so the
+// files are never mistaken for images.
+func (s scanService) quarantine(file in.UploadFile, clientID, signature string) error {
+	dir := filepath.Join(s.QuarantineDir, clientID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%d-%s", now.UnixNano(), file.SHA256)
+	if err := os.Rename(file.Path, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+
+	record, err := json.MarshalIndent(quarantineRecord{
+		ClientID:      clientID,
+		Filename:      file.Filename,
+		SHA256:        file.SHA256,
+		Signature:     signature,
+		QuarantinedAt: now,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("Quarantined %s as %s", file.Filename, name)
+	return os.WriteFile(filepath.Join(dir, name+".json"), record, 0o600)
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"cdn-service/internal/dto/in"
+	"cdn-service/internal/scanner"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanServiceScannerDown(t *testing.T) {
+	// Nothing listens on a port freed right after binding it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	clamd, err := scanner.NewClamd(address, time.Second)
+	if err != nil {
+		t.Fatalf("NewClamd: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "upload.part")
+	if err := os.WriteFile(path, []byte("content"), 0o600); err != nil {
+		t.Fatalf("write upload: %v", err)
+	}
+	file := in.UploadFile{Path: path, Filename: "photo.jpg"}
+
+	tests := []struct {
+		name     string
+		failOpen bool
+		wantErr  error
+	}{
+		{name: "fail closed", failOpen: false, wantErr: ErrScannerUnavailable},
+		{name: "fail open", failOpen: true, wantErr: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanService, err := NewScanService(clamd, tt.failOpen, InfectedReject, "")
+			if err != nil {
+				t.Fatalf("NewScanService: %v", err)
+			}
+			if err := scanService.Check(file, "client"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check error = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("staged upload is gone: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"cdn-service/internal/dto/in"
+	response "cdn-service/internal/dto/out"
+	"cdn-service/internal/imaging"
+	"cdn-service/internal/repository"
+	"cdn-service/internal/utils"
+	"cdn-service/models/uploadtoken"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// uploadTokenAudience keeps upload tokens apart from any other JWT
+const uploadTokenAudience = "cdn-upload"
+
+var (
+	ErrInvalidUploadScope   = errors.New("invalid upload token scope")
+	ErrInvalidUploadToken   = errors.New("invalid upload token")
+	ErrUploadTokenExhausted = errors.New("upload token has no uploads left")
+)
+
+// UploadTokenService mints and checks presigned upload tokens: short-lived
+// credentials a backend hands to a browser so it can upload directly, limited
+// to one client and the scope chosen when minting
+type UploadTokenService interface {
+	Mint(clientID string, request in.UploadTokenRequest) (response.UploadTokenResponse, error)
+	Verify(token string) (*uploadtoken.Scope, error)
+	// Reserve counts count more files against the token, failing once its
+	// MaxCount would be exceeded
+	Reserve(scope *uploadtoken.Scope, count int) error
+	// Release gives back files that were reserved but not stored
+	Release(scope *uploadtoken.Scope, count int)
+}
+
+type uploadTokenService struct {
+	UploadTokenRepository repository.UploadTokenRepository
+	SigningKey            []byte
+	MaxSize               int64
+	MaxCount              int
+	DefaultTTL            time.Duration
+	MaxTTL                time.Duration
+}
+
+type uploadTokenClaims struct {
+	Scope uploadtoken.Scope `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// NewUploadTokenService initializes the service. Tokens are signed with a key
+// derived from secret, so they are never accepted as user tokens.
+func NewUploadTokenService(uploadTokenRepository repository.UploadTokenRepository, secret string, maxSize int64, maxCount int, defaultTTL, maxTTL time.Duration) UploadTokenService {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(uploadTokenAudience))
+	return uploadTokenService{
+		UploadTokenRepository: uploadTokenRepository,
+		SigningKey:            mac.Sum(nil),
+		MaxSize:               maxSize,
+		MaxCount:              maxCount,
+		DefaultTTL:            defaultTTL,
+		MaxTTL:                maxTTL,
+	}
+}
+
+// Mint validates the requested scope, filling in the defaults, and signs a
+// token for it
+func (s uploadTokenService) Mint(clientID string, request in.UploadTokenRequest) (response.UploadTokenResponse, error) {
+	scope := uploadtoken.Scope{
+		ID:       utils.GenerateID(),
+		ClientID: clientID,
+		MaxSize:  request.MaxSize,
+		MaxCount: request.MaxCount,
+		Alias:    request.Alias,
+	}
+	if scope.MaxSize == 0 {
+		scope.MaxSize = s.MaxSize
+	}
+	if scope.MaxSize < 0 || scope.MaxSize > s.MaxSize {
+		return response.UploadTokenResponse{}, fmt.Errorf("%w: max_size must be between 1 and %d", ErrInvalidUploadScope, s.MaxSize)
+	}
+	if scope.MaxCount == 0 {
+		scope.MaxCount = 1
+	}
+	if scope.MaxCount < 0 || scope.MaxCount > s.MaxCount {
+		return response.UploadTokenResponse{}, fmt.Errorf("%w: max_count must be between 1 and %d", ErrInvalidUploadScope, s.MaxCount)
+	}
+	for _, contentType := range request.AllowedTypes {
+		if imaging.FormatFromContentType(contentType) == "" {
+			return response.UploadTokenResponse{}, fmt.Errorf("%w: unsupported type %q", ErrInvalidUploadScope, contentType)
+		}
+		scope.AllowedTypes = append(scope.AllowedTypes, contentType)
+	}
+	if scope.Alias != "" {
+		if err := validAlias(scope.Alias); err != nil {
+			return response.UploadTokenResponse{}, fmt.Errorf("%w: %w", ErrInvalidUploadScope, err)
+		}
+		if scope.Alias == AliasProfile {
+			return response.UploadTokenResponse{}, fmt.Errorf("%w: %q cannot be targeted", ErrInvalidUploadScope, AliasProfile)
+		}
+	}
+
+	ttl := time.Duration(request.TTL) * time.Second
+	if ttl == 0 {
+		ttl = s.DefaultTTL
+	}
+	if ttl < 0 || ttl > s.MaxTTL {
+		return response.UploadTokenResponse{}, fmt.Errorf("%w: ttl must be between 1 and %d seconds", ErrInvalidUploadScope, int(s.MaxTTL.Seconds()))
+	}
+	now := time.Now()
+	scope.ExpiresAt = now.Add(ttl).Truncate(time.Second)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, uploadTokenClaims{
+		Scope: scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        scope.ID,
+			Subject:   clientID,
+			Audience:  jwt.ClaimStrings{uploadTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(scope.ExpiresAt),
+		},
+	}).SignedString(s.SigningKey)
+	if err != nil {
+		return response.UploadTokenResponse{}, err
+	}
+
+	log.Info().Msgf("Minted upload token %s for client %s", scope.ID, clientID)
+	return response.UploadTokenResponse{
+		Token:        token,
+		ExpiresAt:    scope.ExpiresAt,
+		MaxSize:      scope.MaxSize,
+		AllowedTypes: scope.AllowedTypes,
+		MaxCount:     scope.MaxCount,
+		Alias:        scope.Alias,
+	}, nil
+}
+
+// Verify checks the signature, audience and expiry of a token and returns
+// its scope
+func (s uploadTokenService) Verify(token string) (*uploadtoken.Scope, error) {
+	var claims uploadTokenClaims
+	parsed, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return s.SigningKey, nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUploadToken, err)
+	}
+	if !claims.VerifyAudience(uploadTokenAudience, true) || claims.Scope.ID == "" || claims.Scope.ClientID == "" {
+		return nil, ErrInvalidUploadToken
+	}
+	return &claims.Scope, nil
+}
+
+func (s uploadTokenService) Reserve(scope *uploadtoken.Scope, count int) error {
+	used, err := s.UploadTokenRepository.AddUsage(scope.ID, count, s.usageTTL(scope))
+	if err != nil {
+		return err
+	}
+	if used > int64(scope.MaxCount) {
+		s.Release(scope, count)
+		return fmt.Errorf("%w: %d of %d used", ErrUploadTokenExhausted, used-int64(count), scope.MaxCount)
+	}
+	return nil
+}
+
+func (s uploadTokenService) Release(scope *uploadtoken.Scope, count int) {
+	if count == 0 {
+		return
+	}
+	if _, err := s.UploadTokenRepository.AddUsage(scope.ID, -count, s.usageTTL(scope)); err != nil {
+		log.Error().Err(err).Msgf("Failed to release uploads of token %s", scope.ID)
+	}
+}
+
+// usageTTL keeps a counter until its token expires
+func (s uploadTokenService) usageTTL(scope *uploadtoken.Scope) time.Duration {
+	return max(time.Until(scope.ExpiresAt), time.Second)
+}
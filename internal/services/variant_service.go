@@ -0,0 +1,341 @@
+package services
+
+import (
+	"cdn-service/internal/imaging"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrPresetNotFound = errors.New("preset not found")
+	ErrInvalidResize  = errors.New("invalid resize parameters")
+)
+
+// VariantService generates and serves the named preset renditions of images
+type VariantService interface {
+	Presets(scope string) []imaging.Preset
+	VariantURLs(clientID, filename, scope string, animated bool) map[string]string
+	Schedule(clientID, filename, sourcePath, scope string, opts RenderOptions)
+	GetVariant(clientID, filename, sourcePath, scope, preset string, opts RenderOptions) (string, error)
+	GetResized(clientID, filename, sourcePath string, width, height int, fit string, opts RenderOptions) (string, error)
+	GetOriginal(clientID, filename, sourcePath string, opts RenderOptions) (string, error)
+	DeleteVariants(clientID, filename string) error
+	DeleteWatermarked(clientID string) error
+	Run()
+}
+
+// RenderOptions controls how a rendition is produced. Watermarked renditions
+// are cached separately from clean ones, keyed by WatermarkKey so a changed
+// watermark never serves stale output.
+type RenderOptions struct {
+	Hint         imaging.CropHint
+	Watermark    *imaging.Watermark
+	WatermarkKey string
+	Animated     bool // Source is an animated GIF: renditions keep every frame
+}
+
+var (
+	// originalPreset renders the full-size image without resizing
+	originalPreset = imaging.Preset{Name: imaging.PresetOriginal}
+	// posterPreset renders the first frame of an animation, full size
+	posterPreset = imaging.Preset{Name: imaging.PresetPoster}
+)
+
+type variantJob struct {
+	ClientID   string
+	Filename   string
+	SourcePath string
+	Presets    []imaging.Preset
+	Opts       RenderOptions
+}
+
+type variantService struct {
+	VariantDir   string
+	MaxDimension int
+	ResizeStep   int // Ad-hoc sizes must be multiples of it
+	RasterizeSVG bool
+	Pool         *imaging.Pool
+	presets      []imaging.Preset
+	workers      int
+	jobs         chan variantJob
+}
+
+// NewVariantService initializes the service. Ad-hoc renditions are limited to
+// multiples of resizeStep, so that the sizes cached per image stay bounded.
+func NewVariantService(variantDir string, presets []imaging.Preset, maxDimension int, resizeStep int, workers int, queueSize int, rasterizeSVG bool, pool *imaging.Pool) VariantService {
+	if workers < 1 {
+		workers = 1
+	}
+	if resizeStep < 1 {
+		resizeStep = 1
+	}
+	return &variantService{
+		VariantDir:   variantDir,
+		MaxDimension: maxDimension,
+		ResizeStep:   resizeStep,
+		RasterizeSVG: rasterizeSVG,
+		Pool:         pool,
+		presets:      presets,
+		workers:      workers,
+		jobs:         make(chan variantJob, queueSize),
+	}
+}
+
+// Presets returns the presets generated for uploads of the given scope
+func (s *variantService) Presets(scope string) []imaging.Preset {
+	var matching []imaging.Preset
+	for _, p := range s.presets {
+		if p.Matches(scope) {
+			matching = append(matching, p)
+		}
+	}
+	return matching
+}
+
+// VariantURLs returns the public URL of every preset matching the scope, and
+// of the poster frame for animations
+func (s *variantService) VariantURLs(clientID, filename, scope string, animated bool) map[string]string {
+	if imaging.FormatFromExtension(filepath.Ext(filename)) == "" {
+		return nil
+	}
+
+	presets := s.Presets(scope)
+	if animated {
+		presets = append(presets, posterPreset)
+	}
+	if len(presets) == 0 {
+		return nil
+	}
+	urls := make(map[string]string, len(presets))
+	for _, p := range presets {
+		urls[p.Name] = fmt.Sprintf("/cdn/%s/%s/%s", clientID, filename, p.Name)
+	}
+	return urls
+}
+
+// Schedule queues background generation of all presets matching the scope.
+// When the queue is full the job is dropped; variants are then generated on
+// first request instead.
+func (s *variantService) Schedule(clientID, filename, sourcePath, scope string, opts RenderOptions) {
+	if imaging.FormatFromExtension(filepath.Ext(filename)) == "" || s.servesVector(filename) {
+		return
+	}
+	presets := s.Presets(scope)
+	if opts.Animated {
+		presets = append(presets, posterPreset)
+	}
+	if len(presets) == 0 {
+		return
+	}
+
+	select {
+	case s.jobs <- variantJob{ClientID: clientID, Filename: filename, SourcePath: sourcePath, Presets: presets, Opts: opts}:
+	default:
+		log.Warn().Msgf("Variant queue full, %s will be generated on demand", filename)
+	}
+}
+
+// GetVariant returns the path of a preset rendition, generating it first if
+// it does not exist yet. Presets of another scope than the image's are not
+// found.
+func (s *variantService) GetVariant(clientID, filename, sourcePath, scope, preset string, opts RenderOptions) (string, error) {
+	p, ok := s.preset(preset)
+	ok = ok && p.Matches(scope)
+	if preset == imaging.PresetPoster && opts.Animated {
+		p, ok = posterPreset, true
+	}
+	if !ok {
+		return "", ErrPresetNotFound
+	}
+	return s.render(clientID, filename, sourcePath, p, opts)
+}
+
+// GetResized returns the path of an ad-hoc rendition of the given size. A
+// zero width or height keeps the aspect ratio; fit defaults to contain. Sizes
+// must be multiples of the resize step, as every one is rendered and cached.
+func (s *variantService) GetResized(clientID, filename, sourcePath string, width, height int, fit string, opts RenderOptions) (string, error) {
+	if fit == "" {
+		fit = imaging.FitContain
+	}
+	if !imaging.ValidFit(fit) || width < 0 || height < 0 || (width == 0 && height == 0) ||
+		width > s.MaxDimension || height > s.MaxDimension {
+		return "", fmt.Errorf("%w: w and h must be between 0 and %d, fit one of cover, contain, fill", ErrInvalidResize, s.MaxDimension)
+	}
+	if width%s.ResizeStep != 0 || height%s.ResizeStep != 0 {
+		return "", fmt.Errorf("%w: w and h must be multiples of %d", ErrInvalidResize, s.ResizeStep)
+	}
+
+	p := imaging.Preset{Name: fmt.Sprintf("w%d_h%d_%s", width, height, fit), Width: width, Height: height, Fit: fit}
+	return s.render(clientID, filename, sourcePath, p, opts)
+}
+
+// GetOriginal returns the path to serve for the full-size image. Without a
+// watermark, or for files that cannot be decoded, that is the source itself.
+func (s *variantService) GetOriginal(clientID, filename, sourcePath string, opts RenderOptions) (string, error) {
+	if opts.Watermark == nil || imaging.FormatFromExtension(filepath.Ext(filename)) == "" || s.servesVector(filename) {
+		return sourcePath, nil
+	}
+	return s.render(clientID, filename, sourcePath, originalPreset, RenderOptions{Watermark: opts.Watermark, WatermarkKey: opts.WatermarkKey, Animated: opts.Animated})
+}
+
+// render returns the cached rendition or generates it. With rasterization
+// disabled, SVG sources are served as they are for every rendition.
+func (s *variantService) render(clientID, filename, sourcePath string, p imaging.Preset, opts RenderOptions) (string, error) {
+	if s.servesVector(filename) {
+		return sourcePath, nil
+	}
+
+	path := s.variantPath(clientID, filename, p, opts)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if err := s.generate(sourcePath, path, p, opts); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// DeleteVariants removes every generated rendition of an image, so they are
+// regenerated on next request
+func (s *variantService) DeleteVariants(clientID, filename string) error {
+	return os.RemoveAll(filepath.Join(s.VariantDir, filepath.Base(clientID), filepath.Base(filename)))
+}
+
+// DeleteWatermarked removes the watermarked renditions of every image of a
+// client, after its watermark changed or was removed
+func (s *variantService) DeleteWatermarked(clientID string) error {
+	paths, err := filepath.Glob(filepath.Join(s.VariantDir, filepath.Base(clientID), "*", "*.wm*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run starts the background workers
+func (s *variantService) Run() {
+	for i := 0; i < s.workers; i++ {
+		go func() {
+			for job := range s.jobs {
+				for _, p := range job.Presets {
+					path := s.variantPath(job.ClientID, job.Filename, p, job.Opts)
+					if _, err := os.Stat(path); err == nil {
+						continue
+					}
+					if err := s.generate(job.SourcePath, path, p, job.Opts); err != nil {
+						log.Error().Err(err).Msgf("Failed to generate %s for %s", p.Name, job.Filename)
+						break
+					}
+				}
+			}
+		}()
+	}
+}
+
+// servesVector reports whether renditions of filename are the SVG itself
+func (s *variantService) servesVector(filename string) bool {
+	return !s.RasterizeSVG && imaging.FormatFromExtension(filepath.Ext(filename)) == imaging.FormatSVG
+}
+
+func (s *variantService) preset(name string) (imaging.Preset, bool) {
+	for _, p := range s.presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return imaging.Preset{}, false
+}
+
+func (s *variantService) variantPath(clientID, filename string, p imaging.Preset, opts RenderOptions) string {
+	format := imaging.VariantFormat(imaging.FormatFromExtension(filepath.Ext(filename)))
+	if animatedRendition(filename, p, opts) {
+		format = imaging.FormatGIF
+	}
+	name := p.Name
+	if opts.Watermark != nil {
+		name += ".wm" + opts.WatermarkKey
+	}
+	return filepath.Join(s.VariantDir, filepath.Base(clientID), filepath.Base(filename), name+imaging.Extension(format))
+}
+
+// generate renders a preset from the source file
+func (s *variantService) generate(sourcePath, path string, p imaging.Preset, opts RenderOptions) error {
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return err
+	}
+
+	if animatedRendition(sourcePath, p, opts) {
+		encoded, err := imaging.Run(s.Pool, func() ([]byte, error) {
+			g, err := imaging.DecodeAnimation(data)
+			if err != nil {
+				return nil, err
+			}
+			return imaging.EncodeAnimation(imaging.ResizeAnimation(g, p.Width, p.Height, p.Fit, opts.Hint, opts.Watermark))
+		})
+		if err != nil {
+			return err
+		}
+		return writeRendition(path, encoded)
+	}
+
+	encoded, err := imaging.Run(s.Pool, func() ([]byte, error) {
+		img, err := imaging.DecodeAt(data, p.Width, p.Height, p.Fit)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Width != 0 || p.Height != 0 {
+			img = imaging.ResizeWithHint(img, p.Width, p.Height, p.Fit, opts.Hint)
+		}
+		// Renditions are encoded without a colour profile, so their pixels
+		// have to be sRGB
+		img = imaging.NormalizeColor(data, img)
+		if opts.Watermark != nil {
+			img = imaging.ApplyWatermark(img, *opts.Watermark)
+		}
+
+		return imaging.Encode(img, imaging.FormatFromExtension(filepath.Ext(path)), imaging.DefaultQuality)
+	})
+	if err != nil {
+		return err
+	}
+	return writeRendition(path, encoded)
+}
+
+// animatedRendition reports whether a rendition keeps every frame of its
+// source. Only GIF animations can be re-encoded; posters are always still.
+func animatedRendition(filename string, p imaging.Preset, opts RenderOptions) bool {
+	return opts.Animated && p.Name != imaging.PresetPoster &&
+		imaging.FormatFromExtension(filepath.Ext(filename)) == imaging.FormatGIF
+}
+
+// writeRendition writes to a temporary file and renames it into place so
+// readers never see partial output
+func writeRendition(path string, encoded []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(encoded); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
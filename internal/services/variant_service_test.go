@@ -0,0 +1,59 @@
+package services
+
+import (
+	"cdn-service/internal/imaging"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetVariantChecksPresetScope(t *testing.T) {
+	presets, err := imaging.ParsePresets("thumb:32x32:cover:asset,avatar_16:16x16:cover:profile,small:8x8:contain:all")
+	if err != nil {
+		t.Fatalf("ParsePresets: %v", err)
+	}
+	s := NewVariantService(t.TempDir(), presets, 1024, 1, 1, 1, false, imaging.NewPool(1, time.Minute))
+
+	source := filepath.Join(t.TempDir(), "1.png")
+	f, err := os.Create(source)
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("encode source: %v", err)
+	}
+	_ = f.Close()
+
+	tests := []struct {
+		name    string
+		scope   string
+		preset  string
+		wantErr error
+	}{
+		{name: "asset preset on an asset", scope: imaging.ScopeAsset, preset: "thumb"},
+		{name: "profile preset on a profile photo", scope: imaging.ScopeProfile, preset: "avatar_16"},
+		{name: "shared preset on an asset", scope: imaging.ScopeAsset, preset: "small"},
+		{name: "shared preset on a profile photo", scope: imaging.ScopeProfile, preset: "small"},
+		{name: "profile preset on an asset", scope: imaging.ScopeAsset, preset: "avatar_16", wantErr: ErrPresetNotFound},
+		{name: "asset preset on a profile photo", scope: imaging.ScopeProfile, preset: "thumb", wantErr: ErrPresetNotFound},
+		{name: "unknown preset", scope: imaging.ScopeAsset, preset: "huge", wantErr: ErrPresetNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := s.GetVariant("client", "1.png", source, tt.scope, tt.preset, RenderOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetVariant error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("rendition not written: %v", err)
+			}
+		})
+	}
+}
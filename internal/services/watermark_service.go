@@ -0,0 +1,247 @@
+package services
+
+import (
+	"cdn-service/internal/dto/in"
+	response "cdn-service/internal/dto/out"
+	"cdn-service/internal/imaging"
+	"cdn-service/internal/repository"
+	"cdn-service/internal/utils"
+	"cdn-service/models/watermark"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWatermarkOpacity = 0.5
+	defaultWatermarkScale   = 0.25
+	defaultWatermarkMinSize = 200
+)
+
+var (
+	ErrWatermarkNotFound = errors.New("watermark not found")
+	ErrInvalidWatermark  = errors.New("invalid watermark")
+)
+
+// WatermarkService manages the watermark stamped onto a client's public
+// renditions
+type WatermarkService interface {
+	SetWatermark(clientID string, overlay *in.UploadFile, request in.WatermarkRequest) (response.WatermarkResponse, error)
+	GetWatermark(clientID string) (response.WatermarkResponse, error)
+	DeleteWatermark(clientID string) error
+	Load(clientID string) (*imaging.Watermark, string, error)
+	StagingDir() string
+}
+
+type cachedWatermark struct {
+	key       string
+	watermark *imaging.Watermark
+}
+
+type watermarkService struct {
+	WatermarkRepository repository.WatermarkRepository
+	VariantService      VariantService
+	WatermarkDir        string
+	Pool                *imaging.Pool
+
+	mu    sync.Mutex
+	cache map[string]cachedWatermark
+}
+
+// NewWatermarkService initializes the service
+func NewWatermarkService(watermarkRepository repository.WatermarkRepository, variantService VariantService, watermarkDir string, pool *imaging.Pool) WatermarkService {
+	return &watermarkService{
+		WatermarkRepository: watermarkRepository,
+		VariantService:      variantService,
+		WatermarkDir:        watermarkDir,
+		Pool:                pool,
+		cache:               make(map[string]cachedWatermark),
+	}
+}
+
+// SetWatermark creates or updates a client's watermark. The overlay is
+// required the first time; later calls may change only the settings.
+func (s *watermarkService) SetWatermark(clientID string, overlay *in.UploadFile, request in.WatermarkRequest) (response.WatermarkResponse, error) {
+	existing, err := s.WatermarkRepository.GetWatermark(clientID)
+	if err != nil && !errors.Is(err, utils.ErrNoData) {
+		return response.WatermarkResponse{}, err
+	}
+
+	w := &watermark.Watermark{
+		ClientID: clientID,
+		Position: imaging.PositionBottomRight,
+		Opacity:  defaultWatermarkOpacity,
+		Scale:    defaultWatermarkScale,
+		MinSize:  defaultWatermarkMinSize,
+	}
+	if existing != nil {
+		*w = *existing
+	}
+
+	if request.Position != "" {
+		w.Position = request.Position
+	}
+	if request.Opacity != nil {
+		w.Opacity = *request.Opacity
+	}
+	if request.Scale != nil {
+		w.Scale = *request.Scale
+	}
+	if request.MinSize != nil {
+		w.MinSize = *request.MinSize
+	}
+	if !imaging.ValidPosition(w.Position) {
+		return response.WatermarkResponse{}, fmt.Errorf("%w: position must be one of top-left, top-right, bottom-left, bottom-right, center", ErrInvalidWatermark)
+	}
+	if w.Opacity < 0 || w.Opacity > 1 || w.Scale <= 0 || w.Scale > 1 || w.MinSize < 0 {
+		return response.WatermarkResponse{}, fmt.Errorf("%w: opacity must be within 0 and 1, scale within 0 (exclusive) and 1, min_size not negative", ErrInvalidWatermark)
+	}
+
+	if overlay != nil {
+		if err := s.saveOverlay(clientID, *overlay); err != nil {
+			return response.WatermarkResponse{}, err
+		}
+		w.OverlayFile = clientID + ".png"
+	} else if w.OverlayFile == "" {
+		return response.WatermarkResponse{}, fmt.Errorf("%w: an overlay image is required", ErrInvalidWatermark)
+	}
+
+	w.UpdatedAt = time.Now()
+	if err := s.WatermarkRepository.SaveWatermark(w); err != nil {
+		return response.WatermarkResponse{}, err
+	}
+	s.invalidate(clientID)
+
+	log.Info().Msgf("Watermark updated for client: %s", clientID)
+	return toWatermarkResponse(w), nil
+}
+
+// saveOverlay decodes the uploaded overlay and stores it as PNG, so only
+// valid images are kept and transparency is preserved
+func (s *watermarkService) saveOverlay(clientID string, overlay in.UploadFile) error {
+	data, err := os.ReadFile(overlay.Path)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := imaging.Run(s.Pool, func() ([]byte, error) {
+		img, _, err := imaging.Decode(data)
+		if errors.Is(err, imaging.ErrImageTooLarge) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: overlay is not a supported image", ErrInvalidWatermark)
+		}
+		return imaging.Encode(img, imaging.FormatPNG, imaging.DefaultQuality)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.WatermarkDir, os.ModePerm); err != nil {
+		return err
+	}
+	return writeFile(s.overlayPath(clientID), encoded)
+}
+
+// GetWatermark returns a client's watermark settings
+func (s *watermarkService) GetWatermark(clientID string) (response.WatermarkResponse, error) {
+	w, err := s.WatermarkRepository.GetWatermark(clientID)
+	if errors.Is(err, utils.ErrNoData) {
+		return response.WatermarkResponse{}, ErrWatermarkNotFound
+	} else if err != nil {
+		return response.WatermarkResponse{}, err
+	}
+	return toWatermarkResponse(w), nil
+}
+
+// DeleteWatermark stops watermarking a client's images
+func (s *watermarkService) DeleteWatermark(clientID string) error {
+	if _, err := s.WatermarkRepository.GetWatermark(clientID); errors.Is(err, utils.ErrNoData) {
+		return ErrWatermarkNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.WatermarkRepository.DeleteWatermark(clientID); err != nil {
+		return err
+	}
+	if err := os.Remove(s.overlayPath(clientID)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msgf("Failed to delete watermark overlay of client: %s", clientID)
+	}
+	s.invalidate(clientID)
+	return nil
+}
+
+// StagingDir returns the directory uploaded overlays are staged in before
+// they are decoded
+func (s *watermarkService) StagingDir() string {
+	return s.WatermarkDir
+}
+
+// Load returns the decoded watermark of a client together with a key that
+// changes whenever the watermark does. Clients without a watermark get nil.
+func (s *watermarkService) Load(clientID string) (*imaging.Watermark, string, error) {
+	w, err := s.WatermarkRepository.GetWatermark(clientID)
+	if errors.Is(err, utils.ErrNoData) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	key := strconv.FormatInt(w.UpdatedAt.UnixNano(), 36)
+
+	s.mu.Lock()
+	cached, ok := s.cache[clientID]
+	s.mu.Unlock()
+	if ok && cached.key == key {
+		return cached.watermark, key, nil
+	}
+
+	data, err := os.ReadFile(s.overlayPath(clientID))
+	if err != nil {
+		return nil, "", err
+	}
+	overlay, err := imaging.Run(s.Pool, func() (image.Image, error) {
+		img, _, err := imaging.Decode(data)
+		return img, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	wm := &imaging.Watermark{Overlay: overlay, Position: w.Position, Opacity: w.Opacity, Scale: w.Scale, MinSize: w.MinSize}
+	s.mu.Lock()
+	s.cache[clientID] = cachedWatermark{key: key, watermark: wm}
+	s.mu.Unlock()
+	return wm, key, nil
+}
+
+// invalidate drops the cached overlay and the renditions stamped with it
+func (s *watermarkService) invalidate(clientID string) {
+	s.mu.Lock()
+	delete(s.cache, clientID)
+	s.mu.Unlock()
+
+	if err := s.VariantService.DeleteWatermarked(clientID); err != nil {
+		log.Error().Err(err).Msgf("Failed to delete watermarked renditions of client: %s", clientID)
+	}
+}
+
+func (s *watermarkService) overlayPath(clientID string) string {
+	return filepath.Join(s.WatermarkDir, filepath.Base(clientID)+".png")
+}
+
+func toWatermarkResponse(w *watermark.Watermark) response.WatermarkResponse {
+	return response.WatermarkResponse{
+		Position:  w.Position,
+		Opacity:   w.Opacity,
+		Scale:     w.Scale,
+		MinSize:   w.MinSize,
+		UpdatedAt: w.UpdatedAt,
+	}
+}
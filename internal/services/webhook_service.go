@@ -0,0 +1,447 @@
+package services
+
+import (
+	"bytes"
+	"cdn-service/internal/dto/in"
+	"cdn-service/internal/dto/out"
+	"cdn-service/internal/repository"
+	"cdn-service/internal/utils"
+	"cdn-service/models/webhook"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	webhookPollInterval  = time.Second
+	webhookClaimLease    = 2 * time.Minute
+	webhookClaimBatch    = 50
+	webhookBaseBackoff   = 10 * time.Second
+	webhookMaxBackoff    = time.Hour
+	webhookDeliveryLimit = 50
+
+	HeaderWebhookEvent     = "X-CDN-Event"
+	HeaderWebhookDelivery  = "X-CDN-Delivery"
+	HeaderWebhookTimestamp = "X-CDN-Timestamp"
+	HeaderWebhookSignature = "X-CDN-Signature"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+)
+
+// WebhookService manages webhook registrations and delivers signed image events
+type WebhookService interface {
+	RegisterWebhook(clientID string, request in.WebhookRequest) (out.WebhookResponse, error)
+	UpdateWebhook(clientID, webhookID string, request in.WebhookRequest) (out.WebhookResponse, error)
+	GetWebhooks(clientID string) ([]out.WebhookResponse, error)
+	DeleteWebhook(clientID, webhookID string) error
+	GetDeliveries(clientID, webhookID string) ([]out.WebhookDeliveryResponse, error)
+	Redeliver(clientID, webhookID, deliveryID string) (out.WebhookDeliveryResponse, error)
+	Dispatch(clientID, event string, data interface{})
+	Run()
+}
+
+type webhookService struct {
+	WebhookRepository repository.WebhookRepository
+	HTTPClient        *http.Client
+	MaxAttempts       int
+	AllowedNetworks   []*net.IPNet // Private networks webhooks may still be delivered to
+	wake              chan struct{}
+}
+
+// NewWebhookService initializes the service. Deliveries only connect to
+// public addresses and to the allowed networks.
+func NewWebhookService(webhookRepository repository.WebhookRepository, timeout time.Duration, maxAttempts int, allowedNetworks []*net.IPNet) WebhookService {
+	return &webhookService{
+		WebhookRepository: webhookRepository,
+		HTTPClient: &http.Client{
+			Timeout:   timeout,
+			Transport: utils.PublicTransport(timeout, allowedNetworks),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		MaxAttempts:     maxAttempts,
+		AllowedNetworks: allowedNetworks,
+		wake:            make(chan struct{}, 1),
+	}
+}
+
+func (s *webhookService) RegisterWebhook(clientID string, request in.WebhookRequest) (out.WebhookResponse, error) {
+	if err := s.validateWebhookRequest(request); err != nil {
+		return out.WebhookResponse{}, err
+	}
+
+	secret := request.Secret
+	if secret == "" {
+		secret = utils.RandomHex(32)
+	}
+
+	now := time.Now()
+	w := &webhook.Webhook{
+		ID:        utils.GenerateID(),
+		ClientID:  clientID,
+		URL:       request.URL,
+		Secret:    secret,
+		Events:    request.Events,
+		Active:    request.Active == nil || *request.Active,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.WebhookRepository.SaveWebhook(w); err != nil {
+		return out.WebhookResponse{}, err
+	}
+
+	log.Info().Msgf("Webhook %s registered for client: %s", w.ID, clientID)
+
+	resp := toWebhookResponse(*w)
+	resp.Secret = secret
+	return resp, nil
+}
+
+func (s *webhookService) UpdateWebhook(clientID, webhookID string, request in.WebhookRequest) (out.WebhookResponse, error) {
+	if err := s.validateWebhookRequest(request); err != nil {
+		return out.WebhookResponse{}, err
+	}
+
+	w, err := s.getWebhook(clientID, webhookID)
+	if err != nil {
+		return out.WebhookResponse{}, err
+	}
+
+	w.URL = request.URL
+	w.Events = request.Events
+	if request.Secret != "" {
+		w.Secret = request.Secret
+	}
+	if request.Active != nil {
+		w.Active = *request.Active
+	}
+	w.UpdatedAt = time.Now()
+
+	if err := s.WebhookRepository.SaveWebhook(w); err != nil {
+		return out.WebhookResponse{}, err
+	}
+	return toWebhookResponse(*w), nil
+}
+
+func (s *webhookService) GetWebhooks(clientID string) ([]out.WebhookResponse, error) {
+	webhooks, err := s.WebhookRepository.GetWebhooksByClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]out.WebhookResponse, 0, len(webhooks))
+	for _, w := range webhooks {
+		responses = append(responses, toWebhookResponse(w))
+	}
+	return responses, nil
+}
+
+func (s *webhookService) DeleteWebhook(clientID, webhookID string) error {
+	if _, err := s.getWebhook(clientID, webhookID); err != nil {
+		return err
+	}
+	return s.WebhookRepository.DeleteWebhook(clientID, webhookID)
+}
+
+func (s *webhookService) GetDeliveries(clientID, webhookID string) ([]out.WebhookDeliveryResponse, error) {
+	if _, err := s.getWebhook(clientID, webhookID); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.WebhookRepository.GetDeliveriesByWebhook(webhookID, webhookDeliveryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]out.WebhookDeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		responses = append(responses, toWebhookDeliveryResponse(d))
+	}
+	return responses, nil
+}
+
+// Redeliver queues a new delivery carrying the same payload as an earlier one
+func (s *webhookService) Redeliver(clientID, webhookID, deliveryID string) (out.WebhookDeliveryResponse, error) {
+	w, err := s.getWebhook(clientID, webhookID)
+	if err != nil {
+		return out.WebhookDeliveryResponse{}, err
+	}
+
+	original, err := s.WebhookRepository.GetDelivery(deliveryID)
+	if errors.Is(err, utils.ErrNoData) || (err == nil && original.WebhookID != w.ID) {
+		return out.WebhookDeliveryResponse{}, ErrDeliveryNotFound
+	} else if err != nil {
+		return out.WebhookDeliveryResponse{}, err
+	}
+
+	d, err := s.enqueue(*w, original.Event, original.Payload)
+	if err != nil {
+		return out.WebhookDeliveryResponse{}, err
+	}
+	return toWebhookDeliveryResponse(*d), nil
+}
+
+// Dispatch queues a delivery of the event to every active webhook of the client
+// subscribed to it. Failures are logged; they never fail the calling operation.
+func (s *webhookService) Dispatch(clientID, event string, data interface{}) {
+	webhooks, err := s.WebhookRepository.GetWebhooksByClient(clientID)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to load webhooks for client: %s", clientID)
+		return
+	}
+
+	var payload []byte
+	for _, w := range webhooks {
+		if !w.Active || !w.Subscribed(event) {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(webhook.Event{
+				ID:         utils.GenerateID(),
+				Type:       event,
+				ClientID:   clientID,
+				OccurredAt: time.Now(),
+				Data:       data,
+			})
+			if err != nil {
+				log.Error().Err(err).Msgf("Failed to encode %s event", event)
+				return
+			}
+		}
+		if _, err := s.enqueue(w, event, payload); err != nil {
+			log.Error().Err(err).Msgf("Failed to queue %s delivery for webhook %s", event, w.ID)
+		}
+	}
+}
+
+// Run polls the pending queue and delivers due events until the process exits
+func (s *webhookService) Run() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		}
+
+		ids, err := s.WebhookRepository.ClaimDue(time.Now(), webhookClaimLease, webhookClaimBatch)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to claim pending webhook deliveries")
+			continue
+		}
+		for _, id := range ids {
+			s.deliver(id)
+		}
+	}
+}
+
+func (s *webhookService) enqueue(w webhook.Webhook, event string, payload []byte) (*webhook.Delivery, error) {
+	now := time.Now()
+	d := &webhook.Delivery{
+		ID:            utils.GenerateID(),
+		WebhookID:     w.ID,
+		ClientID:      w.ClientID,
+		Event:         event,
+		Payload:       payload,
+		Status:        webhook.DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err := s.WebhookRepository.SaveDelivery(d); err != nil {
+		return nil, err
+	}
+	if err := s.WebhookRepository.AppendDeliveryLog(d); err != nil {
+		return nil, err
+	}
+	if err := s.WebhookRepository.SchedulePending(d.ID, now); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return d, nil
+}
+
+func (s *webhookService) deliver(deliveryID string) {
+	d, err := s.WebhookRepository.GetDelivery(deliveryID)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to load webhook delivery %s", deliveryID)
+		_ = s.WebhookRepository.RemovePending(deliveryID)
+		return
+	}
+
+	w, err := s.WebhookRepository.GetWebhook(d.ClientID, d.WebhookID)
+	if err != nil || !w.Active {
+		d.Status = webhook.DeliveryFailed
+		d.LastError = "webhook removed or inactive"
+		s.settle(d)
+		return
+	}
+
+	d.Attempts++
+	code, err := s.post(*w, *d)
+	d.ResponseCode = code
+	if err == nil {
+		d.Status = webhook.DeliverySucceeded
+		d.LastError = ""
+		s.settle(d)
+		log.Info().Msgf("Webhook delivery %s succeeded after %d attempt(s)", d.ID, d.Attempts)
+		return
+	}
+
+	d.LastError = err.Error()
+	if d.Attempts >= s.MaxAttempts {
+		d.Status = webhook.DeliveryFailed
+		s.settle(d)
+		log.Warn().Err(err).Msgf("Webhook delivery %s gave up after %d attempts", d.ID, d.Attempts)
+		return
+	}
+
+	d.NextAttemptAt = time.Now().Add(webhookBackoff(d.Attempts))
+	d.UpdatedAt = time.Now()
+	if err := s.WebhookRepository.SaveDelivery(d); err != nil {
+		log.Error().Err(err).Msgf("Failed to save webhook delivery %s", d.ID)
+	}
+	if err := s.WebhookRepository.SchedulePending(d.ID, d.NextAttemptAt); err != nil {
+		log.Error().Err(err).Msgf("Failed to reschedule webhook delivery %s", d.ID)
+	}
+}
+
+func (s *webhookService) settle(d *webhook.Delivery) {
+	d.UpdatedAt = time.Now()
+	if err := s.WebhookRepository.SaveDelivery(d); err != nil {
+		log.Error().Err(err).Msgf("Failed to save webhook delivery %s", d.ID)
+	}
+	if err := s.WebhookRepository.RemovePending(d.ID); err != nil {
+		log.Error().Err(err).Msgf("Failed to dequeue webhook delivery %s", d.ID)
+	}
+}
+
+func (s *webhookService) post(w webhook.Webhook, d webhook.Delivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cdn-service-webhook/1.0")
+	req.Header.Set(HeaderWebhookEvent, d.Event)
+	req.Header.Set(HeaderWebhookDelivery, d.ID)
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, "sha256="+SignWebhookPayload(w.Secret, timestamp, d.Payload))
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *webhookService) getWebhook(clientID, webhookID string) (*webhook.Webhook, error) {
+	w, err := s.WebhookRepository.GetWebhook(clientID, webhookID)
+	if errors.Is(err, utils.ErrNoData) {
+		return nil, ErrWebhookNotFound
+	}
+	return w, err
+}
+
+// SignWebhookPayload computes the hex HMAC-SHA256 of "timestamp.payload".
+// Receivers recompute it with their secret to authenticate a delivery.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempt && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+// validateWebhookRequest checks a webhook before it is stored. URLs naming a
+// private address are refused right away; hostnames resolving to one are
+// refused when delivering.
+func (s *webhookService) validateWebhookRequest(request in.WebhookRequest) error {
+	u, err := url.Parse(request.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !utils.AllowedIP(ip, s.AllowedNetworks) {
+		return fmt.Errorf("%w: url must not point at a private address", ErrInvalidWebhook)
+	}
+
+	for _, e := range request.Events {
+		known := false
+		for _, k := range webhook.Events {
+			if e == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, e)
+		}
+	}
+	return nil
+}
+
+func toWebhookResponse(w webhook.Webhook) out.WebhookResponse {
+	return out.WebhookResponse{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    w.Events,
+		Active:    w.Active,
+		CreatedAt: w.CreatedAt,
+		UpdatedAt: w.UpdatedAt,
+	}
+}
+
+func toWebhookDeliveryResponse(d webhook.Delivery) out.WebhookDeliveryResponse {
+	return out.WebhookDeliveryResponse{
+		ID:            d.ID,
+		WebhookID:     d.WebhookID,
+		Event:         d.Event,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		ResponseCode:  d.ResponseCode,
+		LastError:     d.LastError,
+		NextAttemptAt: d.NextAttemptAt,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+	}
+}
@@ -8,6 +8,8 @@ const UserSession = "user_session"
 const ClientID = "client_id"
 const UserID = "user_id"
 const RoleID = "role_id"
+const UploadScope = "upload_scope"
+const ChecksumMismatch = "checksum_mismatch"
 
 const (
 	Admin         = "Admin"
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"bytes"
+	"cdn-service/internal/dto/in"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	ContentDigestHeader = "Content-Digest"
+	ContentMD5Header    = "Content-MD5"
+)
+
+var (
+	ErrInvalidChecksum  = errors.New("invalid checksum")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// contentDigests verifies the digests a client announced for the request
+// content in the Content-Digest (RFC 9530) and Content-MD5 headers. The body
+// is hashed as the upload is read, so it is never buffered.
+type contentDigests struct {
+	io.ReadCloser
+	checks []digestCheck
+}
+
+type digestCheck struct {
+	algorithm string
+	hash      hash.Hash
+	expected  []byte
+}
+
+// newContentDigests parses the digest headers of r and hashes its body from
+// then on. It returns nil when the request announces no digest. Digests with
+// algorithms other than sha-256 and sha-512 are ignored, unless nothing else
+// could be verified.
+func newContentDigests(r *http.Request) (*contentDigests, error) {
+	var checks []digestCheck
+	if header := r.Header.Get(ContentDigestHeader); header != "" {
+		for _, member := range strings.Split(header, ",") {
+			algorithm, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok {
+				return nil, fmt.Errorf("%w: malformed %s", ErrInvalidChecksum, ContentDigestHeader)
+			}
+			algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+			var h hash.Hash
+			switch algorithm {
+			case "sha-256":
+				h = sha256.New()
+			case "sha-512":
+				h = sha512.New()
+			default:
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				return nil, fmt.Errorf("%w: %s must be a byte sequence", ErrInvalidChecksum, algorithm)
+			}
+			expected, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+			if err != nil || len(expected) != h.Size() {
+				return nil, fmt.Errorf("%w: malformed %s digest", ErrInvalidChecksum, algorithm)
+			}
+			checks = append(checks, digestCheck{algorithm: algorithm, hash: h, expected: expected})
+		}
+		if len(checks) == 0 {
+			return nil, fmt.Errorf("%w: %s needs sha-256 or sha-512", ErrInvalidChecksum, ContentDigestHeader)
+		}
+	}
+	if header := r.Header.Get(ContentMD5Header); header != "" {
+		expected, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header))
+		if err != nil || len(expected) != md5.Size {
+			return nil, fmt.Errorf("%w: malformed %s", ErrInvalidChecksum, ContentMD5Header)
+		}
+		checks = append(checks, digestCheck{algorithm: "md5", hash: md5.New(), expected: expected})
+	}
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	d := &contentDigests{ReadCloser: r.Body, checks: checks}
+	r.Body = d
+	return d, nil
+}
+
+func (d *contentDigests) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	for _, check := range d.checks {
+		check.hash.Write(p[:n])
+	}
+	return n, err
+}
+
+// verify reads what is left of body, through whatever limits wrap the
+// digested reader, and compares the announced digests with the content
+func (d *contentDigests) verify(body io.Reader) error {
+	if d == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return err
+	}
+	for _, check := range d.checks {
+		if actual := check.hash.Sum(nil); !bytes.Equal(actual, check.expected) {
+			return fmt.Errorf("%w: %s of the request body is %s, expected %s", ErrChecksumMismatch, check.algorithm,
+				base64.StdEncoding.EncodeToString(actual), base64.StdEncoding.EncodeToString(check.expected))
+		}
+	}
+	return nil
+}
+
+// VerifyChecksums compares staged files with the hex SHA-256 the client sent
+// for each of them, in order. Nothing is checked without checksums.
+func VerifyChecksums(files []in.UploadFile, checksums []string) error {
+	if len(checksums) == 0 {
+		return nil
+	}
+	if len(checksums) != len(files) {
+		return fmt.Errorf("%w: %d sha256 values for %d files", ErrInvalidChecksum, len(checksums), len(files))
+	}
+	for i, file := range files {
+		expected := strings.ToLower(strings.TrimSpace(checksums[i]))
+		if decoded, err := hex.DecodeString(expected); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("%w: sha256 of %s must be 64 hex digits", ErrInvalidChecksum, file.Filename)
+		}
+		if expected != file.SHA256 {
+			return fmt.Errorf("%w: sha256 of %s is %s, expected %s", ErrChecksumMismatch, file.Filename, file.SHA256, expected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"cdn-service/internal/dto/in"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL          = errors.New("invalid url")
+	ErrBlockedDestination  = errors.New("destination not allowed")
+	ErrTooManyRedirects    = errors.New("too many redirects")
+	ErrRemoteStatus        = errors.New("remote server refused the request")
+	ErrRemoteContentType   = errors.New("remote content is not a supported image")
+	ErrRemoteFetchTimedOut = errors.New("remote fetch timed out")
+)
+
+// FetchOptions configures a Fetcher
+type FetchOptions struct {
+	Timeout      time.Duration
+	MaxSize      int64
+	MaxRedirects int
+	// AllowedNetworks are CIDRs that may be fetched from even though they are
+	// private, loopback or link-local
+	AllowedNetworks []*net.IPNet
+	// ContentTypes are the accepted media types of the response
+	ContentTypes []string
+}
+
+// Fetcher downloads remote images on behalf of clients. Every connection,
+// redirects included, goes through PublicTransport.
+type Fetcher struct {
+	client  *http.Client
+	options FetchOptions
+}
+
+// NewFetcher initializes a Fetcher
+func NewFetcher(options FetchOptions) *Fetcher {
+	f := &Fetcher{options: options}
+	f.client = &http.Client{
+		Timeout:   options.Timeout,
+		Transport: PublicTransport(options.Timeout, options.AllowedNetworks),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > options.MaxRedirects {
+				return fmt.Errorf("%w: more than %d", ErrTooManyRedirects, options.MaxRedirects)
+			}
+			return checkScheme(req.URL)
+		},
+	}
+	return f
+}
+
+// PublicTransport returns a transport that only connects to public
+// addresses and to the allowed networks. The address is checked after name
+// resolution, for every connection, so a hostname cannot point the server at
+// its own network.
+func PublicTransport(timeout time.Duration, allowed []*net.IPNet) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address, allowed)
+		},
+	}
+	return &http.Transport{
+		Proxy:                 nil, // A proxy would connect on our behalf, bypassing the checks
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+// AllowedIP reports whether ip is public or inside one of the allowed networks
+func AllowedIP(ip net.IP, allowed []*net.IPNet) bool {
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return publicIP(ip)
+}
+
+// ParseNetworks parses a comma separated list of CIDRs or single addresses
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %v", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Fetch downloads rawURL into a staging file in dir. The response must be
+// successful, declare an accepted image content type and stay within the
+// size limit; the download is aborted as soon as it exceeds it.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL, dir string) (in.UploadFile, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || target.Host == "" {
+		return in.UploadFile{}, fmt.Errorf("%w: %s", ErrInvalidURL, rawURL)
+	}
+	if err := checkScheme(target); err != nil {
+		return in.UploadFile{}, err
+	}
+	if target.User != nil {
+		return in.UploadFile{}, fmt.Errorf("%w: credentials are not allowed in the url", ErrInvalidURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return in.UploadFile{}, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	req.Header.Set("Accept", strings.Join(f.options.ContentTypes, ", "))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return in.UploadFile{}, fetchError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return in.UploadFile{}, fmt.Errorf("%w: status %d", ErrRemoteStatus, resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !f.acceptedType(mediaType) {
+		return in.UploadFile{}, fmt.Errorf("%w: %q", ErrRemoteContentType, mediaType)
+	}
+	if f.options.MaxSize > 0 && resp.ContentLength > f.options.MaxSize {
+		return in.UploadFile{}, fmt.Errorf("%w: %d bytes announced", ErrFileTooLarge, resp.ContentLength)
+	}
+
+	file, err := StageReader(resp.Body, path.Base(resp.Request.URL.Path), dir, f.options.MaxSize)
+	if err != nil && !errors.Is(err, ErrFileTooLarge) {
+		return in.UploadFile{}, fetchError(err)
+	}
+	return file, err
+}
+
+func (f *Fetcher) acceptedType(mediaType string) bool {
+	for _, accepted := range f.options.ContentTypes {
+		if strings.EqualFold(mediaType, accepted) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddress refuses destinations inside private, loopback or link-local
+// ranges unless they are explicitly allowed
+func checkAddress(address string, allowed []*net.IPNet) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedDestination, address)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !AllowedIP(ip, allowed) {
+		return fmt.Errorf("%w: %s", ErrBlockedDestination, host)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598)
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+func publicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if ip4[0] == 0 || sharedAddressSpace.Contains(ip4) {
+			return false
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: only http and https are supported", ErrInvalidURL)
+	}
+	return nil
+}
+
+// fetchError keeps the sentinel errors of a failed request visible to callers
+func fetchError(err error) error {
+	switch {
+	case errors.Is(err, ErrBlockedDestination), errors.Is(err, ErrTooManyRedirects), errors.Is(err, ErrInvalidURL):
+		return err
+	case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+		return fmt.Errorf("%w: %v", ErrRemoteFetchTimedOut, err)
+	}
+	return fmt.Errorf("%w: %v", ErrRemoteStatus, err)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
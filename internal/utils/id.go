@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// GenerateID returns a random 32 character hex identifier
+func GenerateID() string {
+	return RandomHex(16)
+}
+
+// RandomHex returns n random bytes encoded as hex
+func RandomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
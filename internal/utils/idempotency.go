@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"slices"
+)
+
+// stagedFormCheck is the context key of the check a middleware wants run on
+// the staged form of a request
+const stagedFormCheck = "staged_form_check"
+
+// Fingerprint identifies what a staged form carries rather than how it was
+// encoded: its fields in name order and the name and SHA-256 of each file,
+// in upload order. A multipart boundary or a field order chosen anew on a
+// retry does not change it.
+func (f *StagedForm) Fingerprint() string {
+	hash := sha256.New()
+	names := make([]string, 0, len(f.Values))
+	for name := range f.Values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range f.Values[name] {
+			_, _ = fmt.Fprintf(hash, "field %q %q\n", name, value)
+		}
+	}
+	for _, file := range f.Files {
+		_, _ = fmt.Fprintf(hash, "file %q %s\n", file.Filename, file.SHA256)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SetStagedFormCheck registers a check that handlers run on the form they
+// staged, before acting on it. The check may answer the request itself.
+func SetStagedFormCheck(c *gin.Context, check func(form *StagedForm) bool) {
+	c.Set(stagedFormCheck, check)
+}
+
+// CheckStagedForm runs the registered check on a freshly staged form. When
+// it returns false the request was answered and the handler must stop.
+func CheckStagedForm(c *gin.Context, form *StagedForm) bool {
+	check, ok := c.Value(stagedFormCheck).(func(form *StagedForm) bool)
+	return !ok || check(form)
+}
@@ -0,0 +1,353 @@
+package utils
+
+import (
+	"bufio"
+	"cdn-service/internal/dto/in"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var ErrMalformedJSON = errors.New("malformed JSON upload")
+
+// maxDataURIHeader bounds the "data:<type>;base64," prefix of an encoded file
+const maxDataURIHeader = 256
+
+// StreamJSON reads a JSON object whose member field holds a base64 string or
+// a base64 data URI. The encoded file is decoded on the fly into a hidden
+// staging file in dir, like a multipart part, so it is never held in memory;
+// the remaining members are decoded into v and kept, as JSON text, in the
+// form values. A missing or empty field leaves the form without files. The
+// staging file is removed on error. Digests of the body are verified like
+// for multipart uploads.
+func StreamJSON(r *http.Request, field, dir string, limits UploadLimits, v any) (*StagedForm, error) {
+	digests, err := newContentDigests(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxRequestSize > 0 {
+		r.Body = &limitedBody{ReadCloser: r.Body, remaining: limits.MaxRequestSize}
+	}
+	reader := bufio.NewReader(r.Body)
+
+	form := &StagedForm{}
+	fail := func(err error) (*StagedForm, error) {
+		form.Cleanup()
+		return nil, jsonError(err)
+	}
+
+	if err := expectByte(reader, '{'); err != nil {
+		return fail(err)
+	}
+	members := make(map[string]json.RawMessage)
+	if next, err := peekByte(reader); err != nil {
+		return fail(err)
+	} else if next == '}' {
+		_, _ = reader.ReadByte()
+	} else {
+		for {
+			if err := expectByte(reader, '"'); err != nil {
+				return fail(err)
+			}
+			key, err := io.ReadAll(io.LimitReader(&jsonString{r: reader}, maxFormValue))
+			if err != nil {
+				return fail(err)
+			}
+			if err := expectByte(reader, ':'); err != nil {
+				return fail(err)
+			}
+
+			if string(key) == field {
+				if len(form.Files) > 0 {
+					return fail(fmt.Errorf("%w: %s given twice", ErrMalformedJSON, field))
+				}
+				if err := expectByte(reader, '"'); err != nil {
+					return fail(fmt.Errorf("%w: %s must be a string", ErrMalformedJSON, field))
+				}
+				file, err := stageEncoded(&jsonString{r: reader}, dir, limits.MaxFileSize)
+				if err != nil {
+					return fail(err)
+				}
+				if file.Size == 0 {
+					_ = os.Remove(file.Path)
+				} else {
+					form.Files = append(form.Files, file)
+				}
+			} else {
+				value, err := readRawValue(reader)
+				if err != nil {
+					return fail(err)
+				}
+				if _, ok := members[string(key)]; !ok {
+					members[string(key)] = value
+				}
+			}
+
+			separator, err := nextByte(reader)
+			if err != nil {
+				return fail(err)
+			}
+			if separator == '}' {
+				break
+			}
+			if separator != ',' {
+				return fail(fmt.Errorf("%w: unexpected %q", ErrMalformedJSON, separator))
+			}
+		}
+	}
+
+	form.Values = make(map[string][]string, len(members))
+	for name, value := range members {
+		form.Values[name] = []string{string(value)}
+	}
+	if v != nil && len(members) > 0 {
+		data, err := json.Marshal(members)
+		if err != nil {
+			return fail(err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return fail(err)
+		}
+	}
+	if err := digests.verify(reader); err != nil {
+		return fail(err)
+	}
+	return form, nil
+}
+
+// stageEncoded decodes a base64 string, optionally wrapped in a data URI,
+// into a staging file
+func stageEncoded(src io.Reader, dir string, maxSize int64) (in.UploadFile, error) {
+	reader := bufio.NewReaderSize(src, maxDataURIHeader)
+	// A failed peek is not reported again by later reads
+	prefix, err := reader.Peek(5)
+	if err != nil && err != io.EOF {
+		return in.UploadFile{}, err
+	}
+	if strings.EqualFold(string(prefix), "data:") {
+		header, err := reader.ReadSlice(',')
+		if err != nil {
+			return in.UploadFile{}, fmt.Errorf("%w: data URI without payload", ErrMalformedJSON)
+		}
+		lower := strings.ToLower(string(header))
+		if !strings.HasSuffix(lower, ";base64,") {
+			return in.UploadFile{}, fmt.Errorf("%w: only base64 data URIs are supported", ErrMalformedJSON)
+		}
+		// The media type may be omitted, but must not announce something
+		// else than an image
+		mediaType, _, _ := strings.Cut(strings.TrimPrefix(lower, "data:"), ";")
+		if mediaType != "" && !strings.HasPrefix(mediaType, "image/") {
+			return in.UploadFile{}, fmt.Errorf("%w: data URI media type %s is not an image", ErrMalformedJSON, mediaType)
+		}
+	}
+
+	file, err := StageReader(base64.NewDecoder(base64.StdEncoding, reader), "image", dir, maxSize)
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		return in.UploadFile{}, fmt.Errorf("%w: invalid base64 at byte %d", ErrMalformedJSON, int64(corrupt))
+	}
+	return file, err
+}
+
+// readRawValue returns the text of the next JSON value, which must not be
+// longer than a form field. It is validated when decoded.
+func readRawValue(r *bufio.Reader) (json.RawMessage, error) {
+	if _, err := peekByte(r); err != nil {
+		return nil, err
+	}
+	var value []byte
+	depth, inString, escaped := 0, false, false
+	for {
+		if len(value) > maxFormValue {
+			return nil, fmt.Errorf("%w: value longer than %d bytes", ErrMalformedJSON, maxFormValue)
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if inString {
+			value = append(value, c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+				if depth == 0 {
+					return value, nil
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return value, r.UnreadByte()
+			}
+			depth--
+			if depth == 0 {
+				return append(value, c), nil
+			}
+		case ',', ' ', '\t', '\n', '\r':
+			if depth == 0 {
+				return value, r.UnreadByte()
+			}
+		}
+		value = append(value, c)
+	}
+}
+
+// jsonString reads the unescaped content of a JSON string whose opening
+// quote was consumed, up to the closing quote
+type jsonString struct {
+	r       *bufio.Reader
+	pending []byte
+	done    bool
+}
+
+func (s *jsonString) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.pending) > 0 {
+			copied := copy(p[n:], s.pending)
+			s.pending = s.pending[copied:]
+			n += copied
+			continue
+		}
+		if s.done {
+			break
+		}
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		switch {
+		case c == '"':
+			s.done = true
+		case c == '\\':
+			if err := s.unescape(); err != nil {
+				return n, err
+			}
+		case c < 0x20:
+			return n, fmt.Errorf("%w: control character in string", ErrMalformedJSON)
+		default:
+			p[n] = c
+			n++
+		}
+	}
+	if n == 0 && s.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// unescape queues the bytes of the escape sequence following a backslash
+func (s *jsonString) unescape() error {
+	c, err := s.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case '"', '\\', '/':
+		s.pending = []byte{c}
+	case 'b':
+		s.pending = []byte{'\b'}
+	case 'f':
+		s.pending = []byte{'\f'}
+	case 'n':
+		s.pending = []byte{'\n'}
+	case 'r':
+		s.pending = []byte{'\r'}
+	case 't':
+		s.pending = []byte{'\t'}
+	case 'u':
+		r, err := s.readHex()
+		if err != nil {
+			return err
+		}
+		if utf16.IsSurrogate(r) {
+			if next, err := s.r.Peek(2); err == nil && string(next) == "\\u" {
+				_, _ = s.r.Discard(2)
+				low, err := s.readHex()
+				if err != nil {
+					return err
+				}
+				r = utf16.DecodeRune(r, low)
+			} else {
+				r = utf8.RuneError
+			}
+		}
+		s.pending = utf8.AppendRune(nil, r)
+	default:
+		return fmt.Errorf("%w: invalid escape \\%c", ErrMalformedJSON, c)
+	}
+	return nil
+}
+
+func (s *jsonString) readHex() (rune, error) {
+	digits := make([]byte, 4)
+	if _, err := io.ReadFull(s.r, digits); err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(string(digits), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid unicode escape", ErrMalformedJSON)
+	}
+	return rune(value), nil
+}
+
+// peekByte skips whitespace and returns the next byte without consuming it
+func peekByte(r *bufio.Reader) (byte, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return c, r.UnreadByte()
+		}
+	}
+}
+
+// nextByte skips whitespace and consumes the next byte
+func nextByte(r *bufio.Reader) (byte, error) {
+	if _, err := peekByte(r); err != nil {
+		return 0, err
+	}
+	return r.ReadByte()
+}
+
+func expectByte(r *bufio.Reader, expected byte) error {
+	c, err := nextByte(r)
+	if err != nil {
+		return err
+	}
+	if c != expected {
+		return fmt.Errorf("%w: expected %q, got %q", ErrMalformedJSON, expected, c)
+	}
+	return nil
+}
+
+// jsonError keeps limit errors and reports everything else as a malformed body
+func jsonError(err error) error {
+	if errors.Is(err, ErrRequestTooLarge) || errors.Is(err, ErrFileTooLarge) || errors.Is(err, ErrMalformedJSON) || errors.Is(err, ErrChecksumMismatch) {
+		return err
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %v", ErrMalformedJSON, err)
+}
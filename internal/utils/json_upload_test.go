@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"cdn-service/internal/dto/in"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testImage is the start of a PNG file, enough for content sniffing
+var testImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\xff\xfe?")
+
+func streamJSONBody(t *testing.T, body string, limits UploadLimits) (*StagedForm, in.ImageRequest, string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	r := httptest.NewRequest("POST", "/v1/upload/base64", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	var request in.ImageRequest
+	form, err := StreamJSON(r, "image", dir, limits, &request)
+	return form, request, dir, err
+}
+
+func TestStreamJSON(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testImage)
+	// JSON encoders may escape the slashes of base64
+	escaped := strings.ReplaceAll(encoded, "/", `\/`)
+
+	tests := []struct {
+		name           string
+		body           string
+		wantFilename   string
+		wantDuplicates string
+		wantFile       bool
+	}{
+		{name: "base64", body: `{"image":"` + encoded + `"}`, wantFile: true},
+		{name: "data uri", body: `{"image":"data:image/png;base64,` + encoded + `"}`, wantFile: true},
+		{name: "data uri in upper case", body: `{"image":"DATA:IMAGE/PNG;BASE64,` + encoded + `"}`, wantFile: true},
+		{name: "data uri without media type", body: `{"image":"data:;base64,` + encoded + `"}`, wantFile: true},
+		{name: "escaped slashes", body: `{"image":"` + escaped + `"}`, wantFile: true},
+		{name: "unicode escapes", body: `{"image":"` + strings.ReplaceAll(encoded, "A", `\u0041`) + `"}`, wantFile: true},
+		{
+			name:           "escaped members",
+			body:           `{"filename":"café \"1\"\\😀.png", "duplicates":"link", "image":"` + encoded + `"}`,
+			wantFilename:   "café \"1\"\\😀.png",
+			wantDuplicates: "link",
+			wantFile:       true,
+		},
+		{name: "escaped key", body: `{"file\u006eame":"a.png","im\u0061ge":"` + encoded + `"}`, wantFilename: "a.png", wantFile: true},
+		{name: "members around the image", body: " {\n\"duplicates\" : \"link\" ,\n\"image\":\"" + encoded + "\",\n\"filename\":\"a.png\"}\n", wantFilename: "a.png", wantDuplicates: "link", wantFile: true},
+		{name: "empty image", body: `{"image":"","filename":"a.png"}`, wantFilename: "a.png"},
+		{name: "no image", body: `{"filename":"a.png"}`, wantFilename: "a.png"},
+		{name: "empty object", body: `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, request, _, err := streamJSONBody(t, tt.body, UploadLimits{MaxFileSize: 1 << 10, MaxRequestSize: 4 << 10})
+			if err != nil {
+				t.Fatalf("StreamJSON: %v", err)
+			}
+			defer form.Cleanup()
+
+			if request.Filename != tt.wantFilename || request.Duplicates != tt.wantDuplicates {
+				t.Errorf("members = %q, %q, want %q, %q", request.Filename, request.Duplicates, tt.wantFilename, tt.wantDuplicates)
+			}
+			if !tt.wantFile {
+				if len(form.Files) != 0 {
+					t.Fatalf("got %d files, want none", len(form.Files))
+				}
+				return
+			}
+			if len(form.Files) != 1 {
+				t.Fatalf("got %d files, want 1", len(form.Files))
+			}
+			file := form.Files[0]
+			data, err := os.ReadFile(file.Path)
+			if err != nil {
+				t.Fatalf("read staged file: %v", err)
+			}
+			if !bytes.Equal(data, testImage) || file.Size != int64(len(testImage)) {
+				t.Errorf("staged %d bytes, want the %d bytes sent", len(data), len(testImage))
+			}
+			if file.ContentType != "image/png" {
+				t.Errorf("content type = %s, want image/png", file.ContentType)
+			}
+		})
+	}
+}
+
+func TestJSONStringUnescapes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "plain", body: `image"`, want: "image"},
+		{name: "short escapes", body: `\"\\\/\b\f\n\r\t"`, want: "\"\\/\b\f\n\r\t"},
+		{name: "unicode escape", body: `\u0041\u00e9"`, want: "Aé"},
+		{name: "surrogate pair", body: `a\ud83d\ude00b"`, want: "a😀b"},
+		{name: "lone high surrogate", body: `\ud83d.png"`, want: "\ufffd.png"},
+		{name: "lone low surrogate", body: `\ude00"`, want: "\ufffd"},
+		{name: "high surrogate before another escape", body: `\ud83d\n"`, want: "\ufffd\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(&jsonString{r: bufio.NewReader(strings.NewReader(tt.body))})
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamJSONRejects(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testImage)
+	limits := UploadLimits{MaxFileSize: 1 << 10, MaxRequestSize: 4 << 10}
+
+	tests := []struct {
+		name    string
+		body    string
+		limits  UploadLimits
+		wantErr error
+	}{
+		{name: "empty body", body: ``, wantErr: ErrMalformedJSON},
+		{name: "not an object", body: `["image"]`, wantErr: ErrMalformedJSON},
+		{name: "truncated in the image", body: `{"image":"` + encoded[:20], wantErr: ErrMalformedJSON},
+		{name: "truncated before the closing brace", body: `{"image":"` + encoded + `"`, wantErr: ErrMalformedJSON},
+		{name: "truncated in a member", body: `{"image":"` + encoded + `","filename":"a.p`, wantErr: ErrMalformedJSON},
+		{name: "truncated escape", body: `{"filename":"a\u00`, wantErr: ErrMalformedJSON},
+		{name: "missing separator", body: `{"image":"` + encoded + `" "filename":"a.png"}`, wantErr: ErrMalformedJSON},
+		{name: "invalid escape", body: `{"image":"\q"}`, wantErr: ErrMalformedJSON},
+		{name: "invalid escape after the prefix", body: `{"image":"QUJDRA\q=="}`, wantErr: ErrMalformedJSON},
+		{name: "invalid unicode escape", body: `{"image":"\u00zz"}`, wantErr: ErrMalformedJSON},
+		{name: "control character", body: "{\"image\":\"QUJD\nRA==\"}", wantErr: ErrMalformedJSON},
+		{name: "image is not a string", body: `{"image":42}`, wantErr: ErrMalformedJSON},
+		{name: "image given twice", body: `{"image":"` + encoded + `","image":"` + encoded + `"}`, wantErr: ErrMalformedJSON},
+		{name: "padding in the middle", body: `{"image":"QQ==QUJD"}`, wantErr: ErrMalformedJSON},
+		{name: "too much padding", body: `{"image":"QUJD===="}`, wantErr: ErrMalformedJSON},
+		{name: "missing padding", body: `{"image":"QUJDRA"}`, wantErr: ErrMalformedJSON},
+		{name: "url-safe alphabet", body: `{"image":"` + base64.URLEncoding.EncodeToString([]byte{0xfb, 0xff, 0xfe}) + `"}`, wantErr: ErrMalformedJSON},
+		{name: "data uri media type", body: `{"image":"data:text/html;base64,` + encoded + `"}`, wantErr: ErrMalformedJSON},
+		{name: "data uri with parameters", body: `{"image":"data:application/octet-stream;name=a.png;base64,` + encoded + `"}`, wantErr: ErrMalformedJSON},
+		{name: "data uri not base64", body: `{"image":"data:image/png,` + encoded + `"}`, wantErr: ErrMalformedJSON},
+		{name: "data uri without payload", body: `{"image":"data:image/png;base64"}`, wantErr: ErrMalformedJSON},
+		{name: "oversized image", body: `{"image":"` + strings.Repeat("QUJD", 400) + `"}`, wantErr: ErrFileTooLarge},
+		{name: "oversized member", body: `{"filename":"` + strings.Repeat("a", maxFormValue+1) + `"}`, limits: UploadLimits{MaxRequestSize: 1 << 20}, wantErr: ErrMalformedJSON},
+		{name: "oversized key", body: `{"` + strings.Repeat("a", maxFormValue+1) + `":1}`, limits: UploadLimits{MaxRequestSize: 1 << 20}, wantErr: ErrMalformedJSON},
+		{name: "oversized body", body: `{"filename":"` + strings.Repeat("a", 5<<10) + `"}`, wantErr: ErrRequestTooLarge},
+		{name: "invalid member", body: `{"image":"` + encoded + `","preserve_metadata":"yes"}`, wantErr: ErrMalformedJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.limits == (UploadLimits{}) {
+				tt.limits = limits
+			}
+			form, _, dir, err := streamJSONBody(t, tt.body, tt.limits)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("StreamJSON error = %v, want %v", err, tt.wantErr)
+			}
+			if form != nil {
+				t.Errorf("StreamJSON returned a form with its error")
+			}
+			// Nothing staged survives a failed request
+			if entries, err := os.ReadDir(dir); err != nil {
+				t.Fatalf("read staging dir: %v", err)
+			} else if len(entries) != 0 {
+				t.Errorf("%d staging files left behind", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"cdn-service/internal/dto/in"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrFileTooLarge    = errors.New("file exceeds the upload size limit")
+	ErrRequestTooLarge = errors.New("request exceeds the upload size limit")
+	ErrTooManyFiles    = errors.New("too many files in one request")
+	ErrMalformedForm   = errors.New("malformed multipart form")
+)
+
+// maxFormValue bounds the size of a non-file form field
+const maxFormValue = 64 << 10
+
+// UploadLimits bounds a streamed multipart upload. Zero disables a limit.
+type UploadLimits struct {
+	MaxFileSize    int64
+	MaxRequestSize int64
+	MaxFiles       int
+}
+
+// StagedForm is a multipart form whose files were streamed to staging files
+type StagedForm struct {
+	Files  []in.UploadFile
+	Values map[string][]string
+}
+
+// Value returns the first value of a form field
+func (f *StagedForm) Value(name string) string {
+	if values := f.Values[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Cleanup removes the staging files that were not moved into storage
+func (f *StagedForm) Cleanup() {
+	for _, file := range f.Files {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Msgf("Failed to remove staged upload %s", file.Path)
+		}
+	}
+}
+
+// StreamMultipart reads a multipart request part by part. Files of the given
+// field are written to hidden staging files in dir while their SHA-256 is
+// computed and their content type sniffed, so no part is ever held in memory
+// as a whole. Reading stops at the first limit exceeded; the staging files
+// written so far are removed on error. When the request announces a digest
+// of its body, the form is only returned if the body matches it.
+func StreamMultipart(r *http.Request, field, dir string, limits UploadLimits) (*StagedForm, error) {
+	digests, err := newContentDigests(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxRequestSize > 0 {
+		r.Body = &limitedBody{ReadCloser: r.Body, remaining: limits.MaxRequestSize}
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedForm, err)
+	}
+
+	form := &StagedForm{Values: make(map[string][]string)}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			if err := digests.verify(r.Body); err != nil {
+				form.Cleanup()
+				return nil, digestError(err)
+			}
+			return form, nil
+		}
+		if err != nil {
+			form.Cleanup()
+			return nil, streamError(err)
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValue))
+			if err != nil {
+				form.Cleanup()
+				return nil, streamError(err)
+			}
+			form.Values[part.FormName()] = append(form.Values[part.FormName()], string(value))
+			continue
+		}
+
+		if part.FormName() != field {
+			// Unknown file fields are skipped without being stored
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				form.Cleanup()
+				return nil, streamError(err)
+			}
+			continue
+		}
+		if limits.MaxFiles > 0 && len(form.Files) >= limits.MaxFiles {
+			form.Cleanup()
+			return nil, fmt.Errorf("%w: at most %d", ErrTooManyFiles, limits.MaxFiles)
+		}
+
+		file, err := stagePart(part, dir, limits.MaxFileSize)
+		if err != nil {
+			form.Cleanup()
+			return nil, err
+		}
+		form.Files = append(form.Files, file)
+	}
+}
+
+// stagePart copies one file part into a staging file
+func stagePart(part *multipart.Part, dir string, maxSize int64) (in.UploadFile, error) {
+	file, err := StageReader(part, filepath.Base(part.FileName()), dir, maxSize)
+	if err != nil && !errors.Is(err, ErrFileTooLarge) {
+		return in.UploadFile{}, streamError(err)
+	}
+	return file, err
+}
+
+// StageReader copies src into a hidden staging file in dir, computing its
+// SHA-256 and sniffing its content type on the way. Reading stops with
+// ErrFileTooLarge once more than maxSize bytes arrived.
+func StageReader(src io.Reader, filename, dir string, maxSize int64) (in.UploadFile, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return in.UploadFile{}, err
+	}
+	dst, err := os.CreateTemp(dir, ".upload-*.part")
+	if err != nil {
+		return in.UploadFile{}, err
+	}
+	file := in.UploadFile{Filename: filename, Path: dst.Name()}
+
+	fail := func(err error) (in.UploadFile, error) {
+		_ = dst.Close()
+		_ = os.Remove(file.Path)
+		return in.UploadFile{}, err
+	}
+
+	if maxSize > 0 {
+		src = io.LimitReader(src, maxSize+1)
+	}
+	hash := sha256.New()
+	sniff := &sniffer{}
+	size, err := io.Copy(io.MultiWriter(dst, hash, sniff), src)
+	if err != nil {
+		return fail(err)
+	}
+	if maxSize > 0 && size > maxSize {
+		return fail(fmt.Errorf("%w: %s is larger than %d bytes", ErrFileTooLarge, file.Filename, maxSize))
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(file.Path)
+		return in.UploadFile{}, err
+	}
+
+	file.Size = size
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	file.ContentType = http.DetectContentType(sniff.head)
+	return file, nil
+}
+
+// sniffer keeps the leading bytes content type detection looks at
+type sniffer struct {
+	head []byte
+}
+
+func (s *sniffer) Write(p []byte) (int, error) {
+	if missing := 512 - len(s.head); missing > 0 {
+		s.head = append(s.head, p[:min(missing, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// limitedBody fails reads once more than the allowed number of bytes was
+// read from the request
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrRequestTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, ErrRequestTooLarge
+	}
+	return n, err
+}
+
+// digestError keeps the errors of a body verification visible to callers
+func digestError(err error) error {
+	if errors.Is(err, ErrChecksumMismatch) {
+		return err
+	}
+	return streamError(err)
+}
+
+func streamError(err error) error {
+	if errors.Is(err, ErrRequestTooLarge) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrMalformedForm, err)
+}
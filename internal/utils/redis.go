@@ -7,17 +7,33 @@ import (
 	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
 )
 
 // RedisService defines the contract for Redis operations
 type RedisService interface {
 	SaveData(key string, clientID string, data interface{}) error
+	SaveDataWithTTL(key string, clientID string, data interface{}, ttl time.Duration) error
+	SaveDataIfAbsent(key string, clientID string, data interface{}, ttl time.Duration) (bool, error)
 	GetData(key string, clientID string, target interface{}) error
 	DeleteData(key string, clientID string) error
+	IncrementCounter(key string, clientID string, by int64, ttl time.Duration) (int64, error)
 	GetToken(clientID string) (string, error)
 	DeleteToken(clientID string) error
+	AddToSet(key string, member string) error
+	RemoveFromSet(key string, member string) error
+	GetSetMembers(key string) ([]string, error)
+	PushToList(key string, value string, maxLen int64) error
+	GetList(key string, start, stop int64) ([]string, error)
+	AddToSortedSet(key string, member string, score float64) error
+	RemoveFromSortedSet(key string, member string) (bool, error)
+	GetSortedSetByScore(key string, max float64, limit int64) ([]string, error)
 }
 
+// ErrNoData is returned when a key does not exist in Redis
+var ErrNoData = errors.New("no data found for key")
+
 // RedisServiceImpl is the struct that implements RedisService
 type redisService struct {
 	Client redis.Client
@@ -43,12 +59,31 @@ func (r redisService) SaveData(key string, clientID string, data interface{}) er
 	return err
 }
 
+// SaveDataWithTTL stores data in Redis for the given duration
+func (r redisService) SaveDataWithTTL(key string, clientID string, data interface{}, ttl time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data to JSON: %v", err)
+	}
+	return r.Client.Set(r.Ctx, key+":"+clientID, jsonData, ttl).Err()
+}
+
+// SaveDataIfAbsent stores data in Redis for the given duration unless the key
+// already exists, and reports whether it was stored
+func (r redisService) SaveDataIfAbsent(key string, clientID string, data interface{}, ttl time.Duration) (bool, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal data to JSON: %v", err)
+	}
+	return r.Client.SetNX(r.Ctx, key+":"+clientID, jsonData, ttl).Result()
+}
+
 // GetData retrieves data from Redis and unmarshals it into target
 func (r redisService) GetData(key string, clientID string, target interface{}) error {
 	redisKey := key + ":" + clientID
 	jsonData, err := r.Client.Get(r.Ctx, redisKey).Result()
 	if errors.Is(err, redis.Nil) {
-		return fmt.Errorf("no data found for key: %s", redisKey)
+		return fmt.Errorf("%w: %s", ErrNoData, redisKey)
 	} else if err != nil {
 		return fmt.Errorf("failed to get data from Redis: %v", err)
 	}
@@ -67,6 +102,19 @@ func (r redisService) DeleteData(key string, clientID string) error {
 	return err
 }
 
+// IncrementCounter adds by to a counter, creating it if needed, and lets it
+// expire after ttl. The new value is returned.
+func (r redisService) IncrementCounter(key string, clientID string, by int64, ttl time.Duration) (int64, error) {
+	redisKey := key + ":" + clientID
+	pipe := r.Client.TxPipeline()
+	incr := pipe.IncrBy(r.Ctx, redisKey, by)
+	pipe.Expire(r.Ctx, redisKey, ttl)
+	if _, err := pipe.Exec(r.Ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
 // GenerateRedisKey creates a formatted key for token storage
 func generateRedisKey(clientID string) string {
 	return "token:" + clientID
@@ -91,6 +139,60 @@ func (r redisService) DeleteToken(clientID string) error {
 	return err
 }
 
+// AddToSet adds a member to a Redis set
+func (r redisService) AddToSet(key string, member string) error {
+	return r.Client.SAdd(r.Ctx, key, member).Err()
+}
+
+// RemoveFromSet removes a member from a Redis set
+func (r redisService) RemoveFromSet(key string, member string) error {
+	return r.Client.SRem(r.Ctx, key, member).Err()
+}
+
+// GetSetMembers returns all members of a Redis set
+func (r redisService) GetSetMembers(key string) ([]string, error) {
+	return r.Client.SMembers(r.Ctx, key).Result()
+}
+
+// PushToList prepends a value to a Redis list and trims it to maxLen entries
+func (r redisService) PushToList(key string, value string, maxLen int64) error {
+	pipe := r.Client.TxPipeline()
+	pipe.LPush(r.Ctx, key, value)
+	if maxLen > 0 {
+		pipe.LTrim(r.Ctx, key, 0, maxLen-1)
+	}
+	_, err := pipe.Exec(r.Ctx)
+	return err
+}
+
+// GetList returns a range of a Redis list
+func (r redisService) GetList(key string, start, stop int64) ([]string, error) {
+	return r.Client.LRange(r.Ctx, key, start, stop).Result()
+}
+
+// AddToSortedSet adds or updates a member of a Redis sorted set
+func (r redisService) AddToSortedSet(key string, member string, score float64) error {
+	return r.Client.ZAdd(r.Ctx, key, redis.Z{Score: score, Member: member}).Err()
+}
+
+// RemoveFromSortedSet removes a member from a Redis sorted set and reports whether it was present
+func (r redisService) RemoveFromSortedSet(key string, member string) (bool, error) {
+	removed, err := r.Client.ZRem(r.Ctx, key, member).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// GetSortedSetByScore returns up to limit members with a score lower than or equal to max
+func (r redisService) GetSortedSetByScore(key string, max float64, limit int64) ([]string, error) {
+	return r.Client.ZRangeByScore(r.Ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatFloat(max, 'f', -1, 64),
+		Count: limit,
+	}).Result()
+}
+
 func GetUserRedis(redis RedisService, key string, clientID string) (*user.User, error) {
 	var u = &user.User{}
 	err := redis.GetData(key, clientID, u)
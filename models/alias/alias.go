@@ -0,0 +1,16 @@
+package alias
+
+import "time"
+
+// Aliases holds the named aliases of one client
+type Aliases struct {
+	ClientID string           `json:"client_id"`
+	Entries  map[string]Alias `json:"entries"`
+}
+
+// Alias is a stable name pointing at one stored image
+type Alias struct {
+	Name      string    `json:"name"`
+	Filename  string    `json:"filename"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
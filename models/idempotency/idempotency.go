@@ -0,0 +1,18 @@
+package idempotency
+
+import "time"
+
+const (
+	StateInProgress = "in_progress" // The first request is still being handled
+	StateCompleted  = "completed"   // The response is recorded and replayed
+)
+
+// Record tracks one Idempotency-Key of a client
+type Record struct {
+	State       string    `json:"state"`
+	Fingerprint string    `json:"fingerprint,omitempty"` // Identifies the request: its route and form, digest or body
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
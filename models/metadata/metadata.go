@@ -0,0 +1,54 @@
+package metadata
+
+import "time"
+
+// ImageExif holds the EXIF fields extracted from an upload before they were
+// stripped from the served file. It is only ever returned to the owner.
+type ImageExif struct {
+	ClientID    string            `json:"client_id"`
+	Filename    string            `json:"filename"`
+	Orientation int               `json:"orientation"`
+	Fields      map[string]string `json:"fields"`
+	Stripped    bool              `json:"stripped"`
+	ExtractedAt time.Time         `json:"extracted_at"`
+}
+
+// ImageMetadata is the public record kept for every stored image
+type ImageMetadata struct {
+	ClientID    string      `json:"client_id"`
+	Filename    string      `json:"filename"`
+	Scope       string      `json:"scope"` // asset or profile
+	FileType    string      `json:"file_type"`
+	FileSize    int64       `json:"file_size"`
+	Checksum    string      `json:"checksum"` // Hex SHA-256 of the stored bytes
+	Format      string      `json:"format,omitempty"`
+	Width       int         `json:"width,omitempty"`
+	Height      int         `json:"height,omitempty"`
+	HasAlpha    bool        `json:"has_alpha"`
+	Animated    bool        `json:"animated"`
+	FrameCount  int         `json:"frame_count,omitempty"`
+	DurationMs  int64       `json:"duration_ms,omitempty"` // Play time of one loop of an animation
+	Colors      []string    `json:"dominant_colors,omitempty"`
+	BlurHash    string      `json:"blurhash,omitempty"`
+	Placeholder string      `json:"placeholder,omitempty"`
+	PHash       string      `json:"phash,omitempty"`       // Hex dHash used for near-duplicate detection
+	ICCProfile  string      `json:"icc_profile,omitempty"` // Description of the embedded colour profile
+	NonSRGB     bool        `json:"non_srgb"`              // Original carries a colour profile other than sRGB
+	FocalPoint  *FocalPoint `json:"focal_point,omitempty"`
+	CropRect    *CropRect   `json:"crop_rect,omitempty"`
+	UploadedAt  time.Time   `json:"uploaded_at"`
+}
+
+// FocalPoint is the point of interest of an image, as fractions of its size
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// CropRect is the owner-chosen region of an image, as fractions of its size
+type CropRect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
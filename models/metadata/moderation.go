@@ -0,0 +1,22 @@
+package metadata
+
+import "time"
+
+const (
+	ModerationPending  = "pending"  // Held back from the public until reviewed
+	ModerationApproved = "approved" // Served to everyone
+	ModerationRejected = "rejected" // Only ever served to its owner and admins
+)
+
+// Moderation is the review state of one stored image. Images without a
+// record predate moderation and count as approved.
+type Moderation struct {
+	ClientID   string             `json:"client_id"`
+	Filename   string             `json:"filename"`
+	State      string             `json:"state"`
+	Reason     string             `json:"reason,omitempty"`
+	Labels     map[string]float64 `json:"labels,omitempty"`      // Scores reported by the classifier
+	ReviewedBy string             `json:"reviewed_by,omitempty"` // "classifier" or the reviewing admin
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
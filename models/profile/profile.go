@@ -0,0 +1,17 @@
+package profile
+
+import "time"
+
+// History is the list of a client's retained profile photos, newest first.
+// The first photo is the current one.
+type History struct {
+	ClientID  string    `json:"client_id"`
+	Photos    []Photo   `json:"photos"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Photo is one stored profile photo
+type Photo struct {
+	Filename   string    `json:"filename"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
@@ -0,0 +1,14 @@
+package uploadtoken
+
+import "time"
+
+// Scope is what a presigned upload token allows its bearer to do
+type Scope struct {
+	ID           string    `json:"id"`
+	ClientID     string    `json:"client_id"`
+	MaxSize      int64     `json:"max_size"`                // Bytes per file
+	AllowedTypes []string  `json:"allowed_types,omitempty"` // MIME types, empty for any supported image
+	MaxCount     int       `json:"max_count"`               // Files over the token's lifetime
+	Alias        string    `json:"alias,omitempty"`         // Pointed at each stored upload
+	ExpiresAt    time.Time `json:"expires_at"`
+}
@@ -0,0 +1,14 @@
+package watermark
+
+import "time"
+
+// Watermark is a client's watermark configuration
+type Watermark struct {
+	ClientID    string    `json:"client_id"`
+	OverlayFile string    `json:"overlay_file"`
+	Position    string    `json:"position"`
+	Opacity     float64   `json:"opacity"`
+	Scale       float64   `json:"scale"`
+	MinSize     int       `json:"min_size"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
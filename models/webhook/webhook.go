@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventImageUploaded  = "image.uploaded"
+	EventImageDeleted   = "image.deleted"
+	EventImageModerated = "image.moderated"
+)
+
+// Events lists every event type a webhook can subscribe to
+var Events = []string{
+	EventImageUploaded,
+	EventImageDeleted,
+	EventImageModerated,
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	ClientID  string    `json:"client_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Subscribed reports whether the webhook wants to receive the given event
+func (w Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type Delivery struct {
+	ID            string          `json:"id"`
+	WebhookID     string          `json:"webhook_id"`
+	ClientID      string          `json:"client_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// Event is the envelope posted to webhook endpoints
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	ClientID   string      `json:"client_id"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}